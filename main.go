@@ -1,14 +1,48 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 
+	"github.com/albertoboccolini/sqd/models"
 	"github.com/albertoboccolini/sqd/services"
 )
 
+const PARSE_ERROR_EXIT_CODE = 3
+
+// parameterFlag collects the name=value pairs of repeated --param flags.
+type parameterFlag map[string]string
+
+func (parameterFlag parameterFlag) String() string {
+	return ""
+}
+
+func (parameterFlag parameterFlag) Set(value string) error {
+	name, value, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return errors.New("expected name=value")
+	}
+
+	parameterFlag[strings.TrimPrefix(name, ":")] = value
+	return nil
+}
+
+// patternsFlag collects the patterns of repeated --exclude flags.
+type patternsFlag []string
+
+func (patternsFlag *patternsFlag) String() string {
+	return strings.Join(*patternsFlag, ",")
+}
+
+func (patternsFlag *patternsFlag) Set(value string) error {
+	*patternsFlag = append(*patternsFlag, value)
+	return nil
+}
+
 func main() {
 	versionFlag := flag.Bool("version", false, "Print version information")
 	flag.BoolVar(versionFlag, "v", false, "Print version information")
@@ -16,6 +50,20 @@ func main() {
 	flag.BoolVar(transactionFlag, "t", false, "Enable transaction mode with rollback on failure")
 	dryRunFlag := flag.Bool("dry-run", false, "Show what would be done without making changes")
 	flag.BoolVar(dryRunFlag, "d", false, "Show what would be done without making changes")
+	fileFlag := flag.String("file", "", "Read the queries from a file, or from stdin with -")
+	flag.StringVar(fileFlag, "f", "", "Read the queries from a file, or from stdin with -")
+	noIgnoreFlag := flag.Bool("no-ignore", false, "Also search files excluded by .gitignore, .ignore and .sqdignore")
+	hiddenFlag := flag.Bool("hidden", false, "Also search hidden files and directories")
+	var excludes patternsFlag
+	flag.Var(&excludes, "exclude", "Leave out files and directories matching a pattern")
+	maxDepthFlag := flag.Int("max-depth", 0, "Only search this many directories deep")
+	followSymlinksFlag := flag.Bool("follow-symlinks", false, "Follow symbolic links to directories")
+	oneFileSystemFlag := flag.Bool("one-file-system", false, "Do not cross into other file systems")
+	jobsFlag := flag.Int("jobs", runtime.GOMAXPROCS(0), "Process this many files at the same time")
+	flag.IntVar(jobsFlag, "j", runtime.GOMAXPROCS(0), "Process this many files at the same time")
+	parameters := parameterFlag{}
+	flag.Var(parameters, "param", "Bind a value to a :name placeholder, as name=value")
+	flag.Var(parameters, "p", "Bind a value to a :name placeholder, as name=value")
 	flag.Parse()
 
 	if *versionFlag {
@@ -23,37 +71,76 @@ func main() {
 		os.Exit(0)
 	}
 
-	if len(flag.Args()) == 0 {
-		fmt.Println("Usage: sqd 'query'")
+	if len(flag.Args()) == 0 && *fileFlag == "" {
+		fmt.Println("Usage: sqd 'query[; query...]' [value...] | sqd -f script.sql [value...]")
 		fmt.Println("\nCommands:")
 		fmt.Println("  SELECT - Display matching lines")
 		fmt.Println("  UPDATE - Replace content in matching lines")
 		fmt.Println("  DELETE - Remove matching lines")
+		fmt.Println("  INSERT - Add lines at the start or end of files, or around matching lines")
 		fmt.Println("\nExamples:")
-		fmt.Println("  sqd 'SELECT * FROM file.txt WHERE content LIKE pattern'")
-		fmt.Println("  sqd 'UPDATE file.txt SET old TO new WHERE content = match, SET foo TO bar WHERE content = other'")
-		fmt.Println("  sqd 'DELETE FROM file.txt WHERE content = exact_match'")
+		fmt.Println("  sqd \"SELECT * FROM file.txt WHERE content LIKE 'pattern'\"")
+		fmt.Println("  sqd \"UPDATE file.txt SET content = 'new' WHERE content = 'match', SET content = 'bar' WHERE content = 'other'\"")
+		fmt.Println("  sqd \"DELETE FROM file.txt WHERE content = 'exact_match'\"")
+		fmt.Println("  sqd \"INSERT INTO file.txt VALUES ('new line') AFTER WHERE content = 'match'\"")
+		fmt.Println("  sqd --param from=10 \"SELECT * FROM *.md WHERE content LIKE ? AND line > :from\" \"%it's%\"")
+		fmt.Println("\nThe values after the query are bound to its ? placeholders in order.")
 		fmt.Println("\nFlags:")
 		fmt.Println("  -d, --dry-run\t\tShow what would be done without making changes")
+		fmt.Println("  -f, --file		Read the queries from a file, or from stdin with -")
+		fmt.Println("  -j, --jobs		Process this many files at the same time")
+		fmt.Println("  -p, --param		Bind a value to a :name placeholder, as name=value")
+		fmt.Println("  --no-ignore		Also search files excluded by .gitignore, .ignore and .sqdignore")
+		fmt.Println("  --hidden		Also search hidden files and directories")
+		fmt.Println("  --exclude		Leave out files and directories matching a pattern")
+		fmt.Println("  --max-depth		Only search this many directories deep")
+		fmt.Println("  --follow-symlinks	Follow symbolic links to directories")
+		fmt.Println("  --one-file-system	Do not cross into other file systems")
 		fmt.Println("  -t, --transaction	Enable transaction mode with rollback on failure")
 		fmt.Println("  -v, --version		Show the version information")
 		os.Exit(1)
 	}
 
-	sql := strings.Join(flag.Args(), " ")
+	utils := services.NewUtils()
+
+	var sql string
+	positional := flag.Args()
+	if *fileFlag != "" {
+		var err error
+		sql, err = utils.ReadScript(*fileFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		sql, positional = positional[0], positional[1:]
+	}
 
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse(sql)
+	sqlParser.SetParameters(parameters, positional)
+	commands, err := sqlParser.ParseScript(sql)
+	if err != nil {
+		var parseError *models.ParseError
+		if errors.As(err, &parseError) {
+			utils.PrintParseError(sql, parseError)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(PARSE_ERROR_EXIT_CODE)
+	}
 
 	fileFinder := services.NewFileFinder()
-	utils := services.NewUtils()
-
-	files := fileFinder.FindFiles(command.File)
-	if len(files) == 0 {
-		fmt.Println("No files found")
+	fileFinder.SetOptions(models.FindOptions{
+		NoIgnore:       *noIgnoreFlag,
+		Hidden:         *hiddenFlag,
+		Exclude:        excludes,
+		MaxDepth:       *maxDepthFlag,
+		FollowSymlinks: *followSymlinksFlag,
+		OneFileSystem:  *oneFileSystemFlag,
+	})
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.SetWorkers(*jobsFlag)
+	if !fileOperator.ExecuteScript(commands, fileFinder, *transactionFlag, *dryRunFlag) {
 		os.Exit(1)
 	}
-
-	fileOperator := services.NewFileOperator(utils)
-	fileOperator.ExecuteCommand(command, files, *transactionFlag, *dryRunFlag)
 }
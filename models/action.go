@@ -7,4 +7,5 @@ const (
 	COUNT  Action = "COUNT"
 	UPDATE Action = "UPDATE"
 	DELETE Action = "DELETE"
+	INSERT Action = "INSERT"
 )
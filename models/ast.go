@@ -0,0 +1,179 @@
+package models
+
+type Statement interface {
+	statementNode()
+}
+
+type Expression interface {
+	expressionNode()
+}
+
+// SelectStatement lists what to output in Columns, where * is a
+// StarExpression and COUNT(*) a FunctionCall.
+type SelectStatement struct {
+	Distinct bool
+	Columns  []SelectColumn
+	Sources  []string
+	Excludes []string
+	Where    Expression
+	GroupBy  []Expression
+	Having   Expression
+	OrderBy  []OrderTerm
+	Limit    *NumberLiteral
+	Offset   *NumberLiteral
+}
+
+// SelectColumn is an output expression, with the name given by AS if any.
+type SelectColumn struct {
+	Expression Expression
+	Alias      string
+}
+
+// OrderTerm is a single ORDER BY key. A number refers to a SELECT column by
+// position.
+type OrderTerm struct {
+	Expression Expression
+	Descending bool
+}
+
+type UpdateStatement struct {
+	Sources     []string
+	Excludes    []string
+	Assignments []Assignment
+	Limit       *NumberLiteral
+}
+
+// Assignment is a single SET clause. Batch updates carry one Assignment per
+// comma separated SET, each with its own WHERE.
+type Assignment struct {
+	Column *ColumnReference
+	Value  Expression
+	Where  Expression
+}
+
+// InsertStatement adds Values as new lines at Position. Where is only set
+// for AFTER WHERE and BEFORE WHERE.
+type InsertStatement struct {
+	Sources  []string
+	Excludes []string
+	Values   []Expression
+	Position InsertPosition
+	Where    Expression
+	Limit    *NumberLiteral
+}
+
+// DeleteStatement keeps one entry in Wheres per comma separated WHERE clause.
+type DeleteStatement struct {
+	Sources  []string
+	Excludes []string
+	Wheres   []Expression
+	Limit    *NumberLiteral
+}
+
+type ColumnReference struct {
+	Name  string
+	Token Token
+}
+
+type StringLiteral struct {
+	Value string
+	Token Token
+}
+
+type StarExpression struct {
+	Token Token
+}
+
+type NumberLiteral struct {
+	Value float64
+	Token Token
+}
+
+// BetweenExpression is Operand [NOT] BETWEEN Low AND High, bounds included.
+type BetweenExpression struct {
+	Operand Expression
+	Low     Expression
+	High    Expression
+	Negated bool
+}
+
+type ComparisonExpression struct {
+	Operator TokenKind
+	Left     Expression
+	Right    Expression
+}
+
+// LogicalExpression joins two conditions with AND or OR.
+type LogicalExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+type NotExpression struct {
+	Operand Expression
+}
+
+// LikeExpression covers LIKE and ILIKE, optionally negated with NOT and with
+// an ESCAPE character that makes the following % or _ literal.
+type LikeExpression struct {
+	Left            Expression
+	Pattern         *StringLiteral
+	Escape          *StringLiteral
+	CaseInsensitive bool
+	Negated         bool
+}
+
+// FunctionCall is NAME(arguments). Distinct is set for calls such as
+// COUNT(DISTINCT content).
+type FunctionCall struct {
+	Name      string
+	Arguments []Expression
+	Distinct  bool
+	Token     Token
+}
+
+// ConcatExpression is Left || Right.
+type ConcatExpression struct {
+	Left  Expression
+	Right Expression
+}
+
+// CaseExpression is CASE WHEN condition THEN result ... [ELSE result] END.
+type CaseExpression struct {
+	Whens []WhenClause
+	Else  Expression
+	Token Token
+}
+
+type WhenClause struct {
+	Condition Expression
+	Result    Expression
+}
+
+// RegexpExpression is content REGEXP 'pattern', also written with ~ or, when
+// Negated, with !~.
+type RegexpExpression struct {
+	Left    Expression
+	Pattern *StringLiteral
+	Negated bool
+}
+
+func (*SelectStatement) statementNode() {}
+func (*UpdateStatement) statementNode() {}
+func (*DeleteStatement) statementNode() {}
+func (*InsertStatement) statementNode() {}
+
+func (*ColumnReference) expressionNode()      {}
+func (*StringLiteral) expressionNode()        {}
+func (*ComparisonExpression) expressionNode() {}
+func (*NumberLiteral) expressionNode()        {}
+func (*StarExpression) expressionNode()       {}
+func (*BetweenExpression) expressionNode()    {}
+func (*LogicalExpression) expressionNode()    {}
+func (*NotExpression) expressionNode()        {}
+func (*LikeExpression) expressionNode()       {}
+func (*RegexpExpression) expressionNode()     {}
+func (*FunctionCall) expressionNode()         {}
+func (*ConcatExpression) expressionNode()     {}
+func (*CaseExpression) expressionNode()       {}
@@ -0,0 +1,14 @@
+package models
+
+type Column string
+
+const (
+	CONTENT_COLUMN  Column = "content"
+	LINE_COLUMN     Column = "line"
+	PATH_COLUMN     Column = "path"
+	FILENAME_COLUMN Column = "filename"
+	EXT_COLUMN      Column = "ext"
+	DIR_COLUMN      Column = "dir"
+	SIZE_COLUMN     Column = "size"
+	MTIME_COLUMN    Column = "mtime"
+)
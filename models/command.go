@@ -4,24 +4,59 @@ import (
 	"regexp"
 )
 
+// Pattern and MatchExact are only set for an UPDATE whose WHERE has a single
+// content match, possibly ANDed with other filters. It then replaces the text
+// matched by Pattern instead of the whole line.
 type Command struct {
-	Action       Action
-	File         string
-	Pattern      *regexp.Regexp
-	Replace      string
-	MatchExact   bool
+	Action   Action
+	Sources  []string
+	Excludes []string
+	// Columns is empty for SELECT *.
+	Columns []Operand
+	Where   Predicate
+	Pattern *regexp.Regexp
+	// Replace is evaluated for every updated line.
+	Replace    Operand
+	MatchExact bool
+	// Expand resolves $1 and ${name} in Replace against the groups of Pattern.
+	Expand       bool
 	Replacements []Replacement
 	Deletions    []Deletion
 	IsBatch      bool
+	// Distinct drops output rows that were already printed.
+	Distinct bool
+	// IsGrouped is set by GROUP BY, HAVING or an aggregate function.
+	IsGrouped bool
+	GroupBy   []Operand
+	Having    Predicate
+	// Aggregates lists every aggregate the SELECT computes.
+	Aggregates []*AggregateOperand
+	OrderBy    []SortKey
+	HasLimit   bool
+	// Limit only applies when HasLimit is set.
+	Limit int
+	// Offset is only used by SELECT.
+	Offset int
+	// Values holds one operand per line INSERT adds.
+	Values []Operand
+	// Position puts Values at the start or end of the file, or after or before
+	// every line Where matches.
+	Position InsertPosition
 }
 
 type Replacement struct {
+	Where      Predicate
 	Pattern    *regexp.Regexp
-	Replace    string
+	Replace    Operand
 	MatchExact bool
+	Expand     bool
 }
 
 type Deletion struct {
-	Pattern    *regexp.Regexp
-	MatchExact bool
+	Where Predicate
+}
+
+type SortKey struct {
+	Operand    Operand
+	Descending bool
 }
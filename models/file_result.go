@@ -0,0 +1,8 @@
+package models
+
+// FileResult is what processing one file produced: the Count of matched or
+// changed lines, or the error that stopped it.
+type FileResult struct {
+	Count int
+	Err   error
+}
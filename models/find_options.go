@@ -0,0 +1,14 @@
+package models
+
+// FindOptions controls which files a pattern walk visits. By default it skips
+// hidden files and the files .gitignore, .ignore and .sqdignore exclude.
+// Exclude patterns are matched like FROM patterns, and a MaxDepth of 0 walks
+// every level.
+type FindOptions struct {
+	NoIgnore       bool
+	Hidden         bool
+	Exclude        []string
+	MaxDepth       int
+	FollowSymlinks bool
+	OneFileSystem  bool
+}
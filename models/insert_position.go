@@ -0,0 +1,10 @@
+package models
+
+type InsertPosition string
+
+const (
+	INSERT_AT_START InsertPosition = "START"
+	INSERT_AT_END   InsertPosition = "END"
+	INSERT_AFTER    InsertPosition = "AFTER"
+	INSERT_BEFORE   InsertPosition = "BEFORE"
+)
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ParseError struct {
+	Message    string
+	Found      string
+	Expected   []string
+	Suggestion string
+	Position   int
+	Line       int
+	Column     int
+}
+
+func (parseError *ParseError) Error() string {
+	location := fmt.Sprintf("line %d, column %d", parseError.Line, parseError.Column)
+
+	if len(parseError.Expected) == 0 {
+		return fmt.Sprintf("%s: %s", location, parseError.Message)
+	}
+
+	expected := parseError.Expected[0]
+	if count := len(parseError.Expected); count > 1 {
+		expected = strings.Join(parseError.Expected[:count-1], ", ") + " or " + parseError.Expected[count-1]
+	}
+
+	return fmt.Sprintf("%s: expected %s, found %s", location, expected, parseError.Found)
+}
@@ -0,0 +1,95 @@
+package models
+
+import "regexp"
+
+// Predicate is the compiled form of a WHERE clause, evaluated once per line.
+type Predicate interface {
+	predicateNode()
+}
+
+type AndPredicate struct {
+	Left  Predicate
+	Right Predicate
+}
+
+type OrPredicate struct {
+	Left  Predicate
+	Right Predicate
+}
+
+type NotPredicate struct {
+	Operand Predicate
+}
+
+// IsRegexp marks patterns written by the user with REGEXP, whose capture
+// groups can be referenced from an UPDATE replacement.
+type PatternPredicate struct {
+	Operand    Operand
+	Pattern    *regexp.Regexp
+	MatchExact bool
+	IsRegexp   bool
+}
+
+// TruePredicate matches every line.
+type TruePredicate struct{}
+
+type ComparisonPredicate struct {
+	Operator TokenKind
+	Left     Operand
+	Right    Operand
+}
+
+// Operand is the compiled form of a value used by a predicate.
+type Operand interface {
+	operandNode()
+}
+
+type ColumnOperand struct {
+	Column Column
+}
+
+type LiteralOperand struct {
+	Value Value
+}
+
+// CaseOperand evaluates to the Result of the first When whose Condition
+// matches, to Else otherwise, or to an empty value without Else.
+type CaseOperand struct {
+	Whens []CaseWhen
+	Else  Operand
+}
+
+type CaseWhen struct {
+	Condition Predicate
+	Result    Operand
+}
+
+// FunctionOperand is a call to a scalar function such as UPPER(content).
+type FunctionOperand struct {
+	Name      string
+	Arguments []Operand
+}
+
+// AggregateOperand is COUNT, SUM, MIN, MAX or AVG over the rows of a group.
+// Argument is nil for COUNT(*), and Distinct only folds each distinct value
+// of Argument once. Index is the position of the aggregate's result in
+// Row.Aggregates.
+type AggregateOperand struct {
+	Name     string
+	Argument Operand
+	Distinct bool
+	Index    int
+}
+
+func (*AndPredicate) predicateNode()        {}
+func (*OrPredicate) predicateNode()         {}
+func (*NotPredicate) predicateNode()        {}
+func (*PatternPredicate) predicateNode()    {}
+func (*ComparisonPredicate) predicateNode() {}
+func (*TruePredicate) predicateNode()       {}
+
+func (*ColumnOperand) operandNode()    {}
+func (*LiteralOperand) operandNode()   {}
+func (*FunctionOperand) operandNode()  {}
+func (*AggregateOperand) operandNode() {}
+func (*CaseOperand) operandNode()      {}
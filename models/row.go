@@ -0,0 +1,15 @@
+package models
+
+import "os"
+
+// Row is a single line of a file, as seen by WHERE conditions and SELECT
+// columns. Info describes the file the line belongs to. In a grouped SELECT
+// the row is the first line of its group and Aggregates holds the results of
+// the aggregate functions over the whole group.
+type Row struct {
+	Path       string
+	Info       os.FileInfo
+	Line       int
+	Content    string
+	Aggregates []Value
+}
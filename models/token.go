@@ -0,0 +1,41 @@
+package models
+
+type TokenKind string
+
+const (
+	ILLEGAL     TokenKind = "ILLEGAL"
+	EOF         TokenKind = "EOF"
+	IDENT       TokenKind = "IDENT"
+	KEYWORD     TokenKind = "KEYWORD"
+	STRING      TokenKind = "STRING"
+	NUMBER      TokenKind = "NUMBER"
+	PATH        TokenKind = "PATH"
+	PARAMETER   TokenKind = "PARAMETER"
+	STAR        TokenKind = "*"
+	COMMA       TokenKind = ","
+	LEFT_PAREN  TokenKind = "("
+	RIGHT_PAREN TokenKind = ")"
+	EQUAL       TokenKind = "="
+	TILDE       TokenKind = "~"
+	NOT_TILDE   TokenKind = "!~"
+	CONCAT      TokenKind = "||"
+	MINUS       TokenKind = "-"
+	SEMICOLON   TokenKind = ";"
+
+	NOT_EQUAL     TokenKind = "!="
+	LESS_GREATER  TokenKind = "<>"
+	LESS          TokenKind = "<"
+	LESS_EQUAL    TokenKind = "<="
+	GREATER       TokenKind = ">"
+	GREATER_EQUAL TokenKind = ">="
+)
+
+// Position is the byte offset of the token in the query, Line and Column are
+// 1-based and count runes so they can be used to point at the token.
+type Token struct {
+	Kind     TokenKind
+	Value    string
+	Position int
+	Line     int
+	Column   int
+}
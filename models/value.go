@@ -0,0 +1,9 @@
+package models
+
+// Value is the result of evaluating an Operand. Numbers keep their text form
+// too, so they can be compared with string literals and printed as is.
+type Value struct {
+	Text     string
+	Number   float64
+	IsNumber bool
+}
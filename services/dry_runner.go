@@ -4,25 +4,36 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"strings"
 
 	"github.com/albertoboccolini/sqd/models"
 )
 
 type DryRunner struct {
-	utils        *Utils
-	fileOperator *FileOperator
+	utils              *Utils
+	predicateEvaluator *PredicateEvaluator
+	lineInserter       *LineInserter
+	lineReader         *LineReader
 }
 
 func NewDryRunner(utils *Utils) *DryRunner {
-	return &DryRunner{utils: utils}
+	return &DryRunner{
+		utils:              utils,
+		predicateEvaluator: NewPredicateEvaluator(),
+		lineInserter:       NewLineInserter(),
+		lineReader:         NewLineReader(),
+	}
 }
 
 func (dryRunner *DryRunner) Validate(command models.Command, files []string, stats *models.ExecutionStats, useTransaction bool) bool {
 	total := 0
+	limit := newRowLimit(command)
 
 	for _, file := range files {
-		count, ok := dryRunner.validateAndCount(file, command, stats)
+		if limit.done() {
+			break
+		}
+
+		count, ok := dryRunner.validateAndCount(file, command, stats, limit)
 		if !ok {
 			if useTransaction {
 				return false
@@ -35,9 +46,12 @@ func (dryRunner *DryRunner) Validate(command models.Command, files []string, sta
 		stats.Processed++
 	}
 
-	if command.Action == models.UPDATE {
+	switch command.Action {
+	case models.UPDATE:
 		dryRunner.utils.printUpdateMessage(total)
-	} else {
+	case models.INSERT:
+		fmt.Printf("Inserted: %d lines\n", total)
+	default:
 		fmt.Printf("Deleted: %d lines\n", total)
 	}
 
@@ -45,111 +59,141 @@ func (dryRunner *DryRunner) Validate(command models.Command, files []string, sta
 	return true
 }
 
-func (dryRunner *DryRunner) validateAndCount(file string, command models.Command, stats *models.ExecutionStats) (int, bool) {
-	lines, ok := dryRunner.validateAndReadFile(file, stats)
-	if !ok {
+func (dryRunner *DryRunner) validateAndCount(file string, command models.Command, stats *models.ExecutionStats, limit *rowLimit) (int, bool) {
+	if !dryRunner.validateFile(file, stats) {
 		return 0, false
 	}
 
-	if command.Action == models.UPDATE {
-		return dryRunner.countUpdates(lines, command), true
+	var count int
+	var err error
+	switch command.Action {
+	case models.UPDATE:
+		count, err = dryRunner.countUpdates(file, command, limit)
+	case models.INSERT:
+		count, err = dryRunner.countInsertions(file, command, limit)
+	default:
+		count, err = dryRunner.countDeletions(file, command, limit)
 	}
 
-	return dryRunner.countDeletions(lines, command), true
+	if err != nil {
+		dryRunner.fail(err.Error(), stats)
+		return 0, false
+	}
+
+	return count, true
 }
 
-func (dryRunner *DryRunner) countUpdatesInLines(lines []string, pattern *regexp.Regexp, replace string) int {
+func (dryRunner *DryRunner) countUpdatesInLines(file string, where models.Predicate, pattern *regexp.Regexp, replace models.Operand, expand bool, limit *rowLimit) (int, error) {
 	count := 0
-	for _, line := range lines {
-		if pattern.MatchString(line) {
-			newLine := pattern.ReplaceAllLiteralString(line, replace)
-			if newLine != line {
+	err := dryRunner.lineReader.ReadRows(file, file, func(row models.Row) bool {
+		if dryRunner.predicateEvaluator.Matches(where, row) && limit.take() {
+			value := dryRunner.predicateEvaluator.Evaluate(replace, row)
+			newLine := dryRunner.utils.replaceLine(row.Content, pattern, value.Text, expand)
+			if newLine != row.Content {
 				count++
 			}
 		}
-	}
+		return true
+	})
 
-	return count
+	return count, err
 }
 
-func (dryRunner *DryRunner) countUpdatesInLinesInBatch(lines []string, replacements []models.Replacement) int {
+func (dryRunner *DryRunner) countUpdatesInLinesInBatch(file string, replacements []models.Replacement, limit *rowLimit) (int, error) {
 	count := 0
-	for _, line := range lines {
-		original := line
+	err := dryRunner.lineReader.ReadRows(file, file, func(row models.Row) bool {
+		line := row.Content
 		for _, replacement := range replacements {
-			if replacement.Pattern.MatchString(line) {
-				line = replacement.Pattern.ReplaceAllLiteralString(line, replacement.Replace)
+			if dryRunner.predicateEvaluator.Matches(replacement.Where, row) {
+				if limit.take() {
+					value := dryRunner.predicateEvaluator.Evaluate(replacement.Replace, row)
+					line = dryRunner.utils.replaceLine(line, replacement.Pattern, value.Text, replacement.Expand)
+				}
 				break
 			}
 		}
 
-		if line != original {
+		if line != row.Content {
 			count++
 		}
-	}
+		return true
+	})
 
-	return count
+	return count, err
 }
 
-func (dryRunner *DryRunner) countDeletionsInLines(lines []string, pattern *regexp.Regexp) int {
+func (dryRunner *DryRunner) countDeletionsInLines(file string, where models.Predicate, limit *rowLimit) (int, error) {
 	count := 0
-	for _, line := range lines {
-		if pattern.MatchString(line) {
+	err := dryRunner.lineReader.ReadRows(file, file, func(row models.Row) bool {
+		if dryRunner.predicateEvaluator.Matches(where, row) && limit.take() {
 			count++
 		}
-	}
+		return true
+	})
 
-	return count
+	return count, err
 }
 
-func (dryRunner *DryRunner) countDeletionsInLinesInBatch(lines []string, deletions []models.Deletion) int {
+func (dryRunner *DryRunner) countDeletionsInLinesInBatch(file string, deletions []models.Deletion, limit *rowLimit) (int, error) {
 	count := 0
-	for _, line := range lines {
+	err := dryRunner.lineReader.ReadRows(file, file, func(row models.Row) bool {
 		for _, deletion := range deletions {
-			if deletion.Pattern.MatchString(line) {
-				count++
+			if dryRunner.predicateEvaluator.Matches(deletion.Where, row) {
+				if limit.take() {
+					count++
+				}
 				break
 			}
 		}
-	}
+		return true
+	})
 
-	return count
+	return count, err
 }
 
-func (dryRunner *DryRunner) countUpdates(lines []string, command models.Command) int {
+func (dryRunner *DryRunner) countUpdates(file string, command models.Command, limit *rowLimit) (int, error) {
 	if command.IsBatch {
-		return dryRunner.countUpdatesInLinesInBatch(lines, command.Replacements)
+		return dryRunner.countUpdatesInLinesInBatch(file, command.Replacements, limit)
 	}
 
-	return dryRunner.countUpdatesInLines(lines, command.Pattern, command.Replace)
+	return dryRunner.countUpdatesInLines(file, command.Where, command.Pattern, command.Replace, command.Expand, limit)
 }
 
-func (dryRunner *DryRunner) countDeletions(lines []string, command models.Command) int {
+func (dryRunner *DryRunner) countDeletions(file string, command models.Command, limit *rowLimit) (int, error) {
 	if command.IsBatch {
-		return dryRunner.countDeletionsInLinesInBatch(lines, command.Deletions)
+		return dryRunner.countDeletionsInLinesInBatch(file, command.Deletions, limit)
 	}
 
-	return dryRunner.countDeletionsInLines(lines, command.Pattern)
+	return dryRunner.countDeletionsInLines(file, command.Where, limit)
 }
 
-func (dryRunner *DryRunner) validateAndReadFile(file string, stats *models.ExecutionStats) ([]string, bool) {
+func (dryRunner *DryRunner) countInsertions(file string, command models.Command, limit *rowLimit) (int, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return dryRunner.lineInserter.Insert(input, file, info, command, limit.take, func(line string) {})
+}
+
+func (dryRunner *DryRunner) validateFile(file string, stats *models.ExecutionStats) bool {
 	if !dryRunner.utils.IsPathInsideCwd(file) {
 		dryRunner.fail("invalid path: "+file, stats)
-		return nil, false
+		return false
 	}
 
 	if !dryRunner.utils.canWriteFile(file) {
 		dryRunner.fail("permission denied: "+file, stats)
-		return nil, false
-	}
-
-	data, err := os.ReadFile(file)
-	if err != nil {
-		dryRunner.fail(err.Error(), stats)
-		return nil, false
+		return false
 	}
 
-	return strings.Split(string(data), "\n"), true
+	return true
 }
 
 func (dryRunner *DryRunner) fail(msg string, stats *models.ExecutionStats) {
@@ -0,0 +1,8 @@
+//go:build windows
+
+package services
+
+// fileDevice is not available on Windows, where OneFileSystem has no effect.
+func fileDevice(path string) (uint64, bool) {
+	return 0, false
+}
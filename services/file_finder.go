@@ -1,36 +1,39 @@
 package services
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/albertoboccolini/sqd/models"
 )
 
+// GLOB_CHARACTERS turn a FROM source into a pattern instead of a file name.
+const GLOB_CHARACTERS = "*?[{"
+
 type FileFinder struct {
-	maxTextFileSize int64
-	bufferSize      int
+	bufferSize    int
+	options       models.FindOptions
+	ignoreMatcher *IgnoreMatcher
 }
 
 func NewFileFinder() *FileFinder {
 	return &FileFinder{
-		maxTextFileSize: 100 * 1024 * 1024,
-		bufferSize:      8000,
+		bufferSize:    8000,
+		ignoreMatcher: NewIgnoreMatcher(),
 	}
 }
 
-// If the file cannot be stat'ed or opened, the function returns true so that
+func (fileFinder *FileFinder) SetOptions(options models.FindOptions) {
+	fileFinder.options = options
+}
+
+// If the file cannot be opened, the function returns true so that
 // callers like FindFiles do not silently skip those paths.
 func (fileFinder *FileFinder) IsTextFile(path string) bool {
-	info, err := os.Stat(path)
-	if err != nil {
-		return true
-	}
-
-	if info.Size() > fileFinder.maxTextFileSize {
-		return false
-	}
-
 	file, err := os.Open(path)
 	if err != nil {
 		return true
@@ -53,29 +56,305 @@ func (fileFinder *FileFinder) IsTextFile(path string) bool {
 	return true
 }
 
-func (fileFinder *FileFinder) FindFiles(pattern string) []string {
-	if !strings.Contains(pattern, "*") {
-		return []string{pattern}
-	}
+func (fileFinder *FileFinder) FindFiles(patterns ...string) []string {
+	return fileFinder.FindSources(patterns, nil)
+}
 
+// FindSources lists the files of patterns, leaving out those that match one
+// of excludes or an Exclude option.
+func (fileFinder *FileFinder) FindSources(patterns []string, excludes []string) []string {
 	var files []string
 
-	filepath.WalkDir(".", func(path string, entry fs.DirEntry, err error) error {
+	fileFinder.WalkSources(patterns, excludes, func(path string) bool {
+		files = append(files, path)
+		return true
+	})
+
+	return files
+}
+
+// WalkSources calls visit for the text files of every pattern in turn,
+// skipping files that an earlier pattern already matched, until visit returns
+// false. A pattern without a slash matches file names at any depth; otherwise
+// it matches the path relative to the current directory, where ** spans
+// directories. A pattern without glob characters is a path.
+func (fileFinder *FileFinder) WalkSources(patterns []string, excludes []string, visit func(path string) bool) {
+	walk, err := fileFinder.newFileWalk(excludes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	stopped := false
+
+	for _, pattern := range patterns {
+		fileFinder.walkPattern(walk, pattern, func(path string) bool {
+			key := filepath.Clean(path)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+
+			stopped = !visit(path)
+			return !stopped
+		})
+
+		if stopped {
+			return
+		}
+	}
+}
+
+// fileWalk is the state shared by the patterns of one WalkSources call.
+type fileWalk struct {
+	excludes    []*regexp.Regexp
+	visitedDirs map[string]bool
+	matcher     *regexp.Regexp
+	device      uint64
+	hasDevice   bool
+	visit       func(path string) bool
+}
+
+func (fileFinder *FileFinder) newFileWalk(excludes []string) (*fileWalk, error) {
+	walk := &fileWalk{visitedDirs: make(map[string]bool)}
+
+	for _, exclude := range append(append([]string{}, fileFinder.options.Exclude...), excludes...) {
+		exclude = strings.TrimPrefix(filepath.ToSlash(exclude), "./")
+		matcher, err := globToRegex(exclude, strings.Contains(exclude, "/"), true)
 		if err != nil {
-			return nil
+			return nil, fmt.Errorf("invalid exclude pattern %s: %v", exclude, err)
+		}
+		walk.excludes = append(walk.excludes, matcher)
+	}
+
+	return walk, nil
+}
+
+func (fileFinder *FileFinder) walkPattern(walk *fileWalk, pattern string, visit func(path string) bool) {
+	if !strings.ContainsAny(pattern, GLOB_CHARACTERS) {
+		if !fileFinder.isExcluded(walk, pattern, false) {
+			visit(pattern)
+		}
+		return
+	}
+
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	matcher, err := globToRegex(pattern, strings.Contains(pattern, "/"), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid pattern %s: %v\n", pattern, err)
+		return
+	}
+
+	root := fileFinder.walkRoot(pattern)
+	walk.matcher = matcher
+	walk.visit = visit
+	walk.device, walk.hasDevice = fileDevice(root)
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		walk.visitedDirs[realRoot] = true
+	}
+
+	depth := 0
+	if root != "." && !filepath.IsAbs(root) {
+		depth = strings.Count(root, "/") + 1
+	}
+
+	fileFinder.walkDir(walk, root, depth)
+}
+
+// walkDir visits the entries of dir, which is depth directories below the
+// current directory, and returns false once visit asked to stop. Excluded,
+// ignored and too deep directories are never read.
+func (fileFinder *FileFinder) walkDir(walk *fileWalk, dir string, depth int) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		isSymlink := entry.Type()&fs.ModeSymlink != 0
+		isDir := entry.IsDir()
+
+		if isSymlink && fileFinder.options.FollowSymlinks {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			isDir = info.IsDir()
 		}
 
-		if entry.IsDir() {
-			return nil
+		if fileFinder.isSkipped(path, entry.Name(), isDir) || fileFinder.isExcluded(walk, path, isDir) {
+			continue
 		}
 
-		matched, _ := filepath.Match(pattern, filepath.Base(path))
-		if matched && fileFinder.IsTextFile(path) {
-			files = append(files, path)
+		if fileFinder.options.MaxDepth > 0 && depth+1 > fileFinder.options.MaxDepth {
+			continue
 		}
 
-		return nil
-	})
+		if isDir {
+			if !fileFinder.isWalkable(walk, path, isSymlink) {
+				continue
+			}
 
-	return files
+			if !fileFinder.walkDir(walk, path, depth+1) {
+				return false
+			}
+			continue
+		}
+
+		if strings.HasSuffix(path, BACKUP_SUFFIX) || strings.HasSuffix(path, TEMP_SUFFIX) || !walk.matcher.MatchString(filepath.ToSlash(path)) {
+			continue
+		}
+
+		if fileFinder.IsTextFile(path) && !walk.visit(path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isWalkable keeps the walk on the starting file system with OneFileSystem,
+// and out of directories a followed symlink already led to.
+func (fileFinder *FileFinder) isWalkable(walk *fileWalk, dir string, isSymlink bool) bool {
+	if fileFinder.options.OneFileSystem && walk.hasDevice {
+		if device, ok := fileDevice(dir); ok && device != walk.device {
+			return false
+		}
+	}
+
+	if !fileFinder.options.FollowSymlinks {
+		return true
+	}
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil || walk.visitedDirs[realDir] {
+		return false
+	}
+	walk.visitedDirs[realDir] = true
+
+	return true
+}
+
+// isSkipped reports whether the walk leaves out path: .git directories
+// always, hidden entries without the Hidden option and ignored ones unless
+// NoIgnore is set.
+func (fileFinder *FileFinder) isSkipped(path string, name string, isDir bool) bool {
+	if isDir && name == ".git" {
+		return true
+	}
+
+	if !fileFinder.options.Hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	return !fileFinder.options.NoIgnore && fileFinder.ignoreMatcher.IsIgnored(path, isDir)
+}
+
+// isExcluded also tests directories with a trailing slash, so that vendor/**
+// skips the vendor directory itself.
+func (fileFinder *FileFinder) isExcluded(walk *fileWalk, path string, isDir bool) bool {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "./")
+
+	for _, exclude := range walk.excludes {
+		if exclude.MatchString(path) || (isDir && exclude.MatchString(path+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkRoot is the leading directories of pattern that contain no glob
+// characters, so that docs/**/*.md only walks docs.
+func (fileFinder *FileFinder) walkRoot(pattern string) string {
+	segments := strings.Split(pattern, "/")
+
+	var root []string
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, GLOB_CHARACTERS) {
+			break
+		}
+		root = append(root, segment)
+	}
+
+	if len(root) == 0 {
+		return "."
+	}
+
+	if root[0] == "" {
+		return "/" + strings.Join(root[1:], "/")
+	}
+
+	return strings.Join(root, "/")
+}
+
+// globToRegex translates *, ?, [...], ** and, with braces, {a,b} into a
+// regular expression over slash separated paths. A pattern that is not
+// anchored matches at any depth.
+func globToRegex(pattern string, anchored bool, braces bool) (*regexp.Regexp, error) {
+	var expression strings.Builder
+	openBraces := 0
+
+	for index := 0; index < len(pattern); index++ {
+		char := pattern[index]
+
+		switch {
+		case char == '\\' && index+1 < len(pattern):
+			index++
+			expression.WriteString(regexp.QuoteMeta(pattern[index : index+1]))
+
+		case strings.HasPrefix(pattern[index:], "**/") && (index == 0 || pattern[index-1] == '/'):
+			expression.WriteString("(?:.*/)?")
+			index += 2
+
+		case strings.HasPrefix(pattern[index:], "**"):
+			expression.WriteString(".*")
+			index++
+
+		case char == '*':
+			expression.WriteString("[^/]*")
+
+		case char == '?':
+			expression.WriteString("[^/]")
+
+		case char == '[':
+			end := strings.IndexByte(pattern[index+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			class := pattern[index+1 : index+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			index += end + 1
+
+		case char == '{' && braces:
+			expression.WriteString("(?:")
+			openBraces++
+
+		case char == ',' && openBraces > 0:
+			expression.WriteString("|")
+
+		case char == '}' && openBraces > 0:
+			expression.WriteString(")")
+			openBraces--
+
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	if openBraces > 0 {
+		return nil, fmt.Errorf("unclosed {")
+	}
+
+	prefix := "^"
+	if !anchored {
+		prefix = "^(?:.*/)?"
+	}
+
+	return regexp.Compile(prefix + expression.String() + "$")
 }
@@ -2,367 +2,619 @@ package services
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/albertoboccolini/sqd/models"
 )
 
+const BACKUP_SUFFIX = ".sqd_backup"
+
 type fileBackup struct {
 	original string
 	backup   string
 }
 
+// rowLimit tracks how many rows a LIMIT and OFFSET still let through, across
+// all the files of a statement.
+type rowLimit struct {
+	limited   bool
+	offset    int
+	remaining int
+}
+
+func newRowLimit(command models.Command) *rowLimit {
+	return &rowLimit{limited: command.HasLimit, offset: command.Offset, remaining: command.Limit}
+}
+
+// take reports whether the next matching row is inside the window.
+func (rowLimit *rowLimit) take() bool {
+	if rowLimit.offset > 0 {
+		rowLimit.offset--
+		return false
+	}
+
+	if !rowLimit.limited {
+		return true
+	}
+
+	if rowLimit.remaining == 0 {
+		return false
+	}
+
+	rowLimit.remaining--
+	return true
+}
+
+func (rowLimit *rowLimit) done() bool {
+	return rowLimit.limited && rowLimit.remaining == 0
+}
+
 type FileOperator struct {
-	utils     *Utils
-	dryRunner *DryRunner
+	utils              *Utils
+	dryRunner          *DryRunner
+	predicateEvaluator *PredicateEvaluator
+	lineInserter       *LineInserter
+	filePool           *FilePool
+	lineReader         *LineReader
+	fileRewriter       *FileRewriter
 }
 
 func NewFileOperator(utils *Utils) *FileOperator {
 	fileOperator := &FileOperator{
-		utils:     utils,
-		dryRunner: NewDryRunner(utils),
+		utils:              utils,
+		dryRunner:          NewDryRunner(utils),
+		predicateEvaluator: NewPredicateEvaluator(),
+		lineInserter:       NewLineInserter(),
+		filePool:           NewFilePool(runtime.GOMAXPROCS(0)),
+		lineReader:         NewLineReader(),
+		fileRewriter:       NewFileRewriter(),
 	}
 	return fileOperator
 }
 
-func (fileOperator *FileOperator) ExecuteCommand(command models.Command, files []string, useTransaction bool, dryRun bool) {
-	stats := models.ExecutionStats{StartTime: time.Now()}
-
-	if command.Pattern == nil && ((command.Action == models.SELECT ||
-		command.Action == models.COUNT ||
-		command.Action == models.UPDATE ||
-		command.Action == models.DELETE) && !command.IsBatch) {
-		fmt.Fprintf(os.Stderr, "Error: Invalid query pattern\n")
-		return
-	}
+// SetWorkers sets how many files are processed at the same time.
+func (fileOperator *FileOperator) SetWorkers(workers int) {
+	fileOperator.filePool = NewFilePool(workers)
+}
 
-	if command.Action == models.UPDATE && !command.IsBatch && command.Replace == "" {
-		fmt.Fprintf(os.Stderr, "Error: Invalid replacement value\n")
-		return
-	}
+func (fileOperator *FileOperator) ExecuteCommand(command models.Command, files []string, useTransaction bool, dryRun bool) bool {
+	stats := models.ExecutionStats{StartTime: time.Now()}
 
 	if command.Action == models.COUNT {
-		total := 0
-		for _, file := range files {
-			count, err := fileOperator.countMatches(file, command.Pattern)
-			if err != nil {
-				fileOperator.utils.printProcessingErrorMessage(file, err)
-				stats.Skipped++
-				continue
-			}
-			total += count
-			stats.Processed++
-		}
+		total := fileOperator.countFiles(command, walkList(files), &stats)
 
 		fmt.Printf("%d lines matched\n", total)
 		fileOperator.utils.printStats(stats)
-		return
+		return stats.Skipped == 0
 	}
 
 	if command.Action == models.SELECT {
-		for _, file := range files {
-			err := fileOperator.selectMatches(file, command.Pattern)
-			if err != nil {
-				fileOperator.utils.printProcessingErrorMessage(file, err)
-				stats.Skipped++
-				continue
-			}
-			stats.Processed++
-		}
+		fileOperator.selectFiles(command, walkList(files), &stats)
 
 		fileOperator.utils.printStats(stats)
-		return
+		return stats.Skipped == 0
 	}
 
 	if command.Action == models.UPDATE {
 		if dryRun {
-			fileOperator.executeDryRun(command, files, useTransaction, stats)
-			return
+			return fileOperator.executeDryRun(command, files, useTransaction, stats)
 		}
 
 		if useTransaction {
-			fileOperator.executeUpdateTransaction(command, files, &stats)
-			return
-		}
-
-		total := 0
-		if command.IsBatch {
-			for _, file := range files {
-				count, err := fileOperator.updateFileInBatch(file, command.Replacements)
-				if err != nil {
-					fileOperator.utils.printProcessingErrorMessage(file, err)
-					stats.Skipped++
-					continue
-				}
-				total += count
-				stats.Processed++
-			}
-
-			fileOperator.utils.printUpdateMessage(total)
-			fileOperator.utils.printStats(stats)
-			return
+			return fileOperator.executeUpdateTransaction(command, files, &stats)
 		}
 
-		for _, file := range files {
-			count, err := fileOperator.updateFile(file, command.Pattern, command.Replace)
-			if err != nil {
-				fileOperator.utils.printProcessingErrorMessage(file, err)
-				stats.Skipped++
-				continue
+		total := fileOperator.changeFiles(command, files, &stats, func(file string, limit *rowLimit) (int, error) {
+			if command.IsBatch {
+				return fileOperator.updateFileInBatch(file, command.Replacements, limit)
 			}
-			total += count
-			stats.Processed++
-		}
+			return fileOperator.updateFile(file, command.Where, command.Pattern, command.Replace, command.Expand, limit)
+		})
 
 		fileOperator.utils.printUpdateMessage(total)
 		fileOperator.utils.printStats(stats)
-		return
+		return stats.Skipped == 0
 	}
 
 	if command.Action == models.DELETE {
 		if dryRun {
-			fileOperator.executeDryRun(command, files, useTransaction, stats)
-			return
+			return fileOperator.executeDryRun(command, files, useTransaction, stats)
 		}
 
 		if useTransaction {
-			fileOperator.executeDeleteTransaction(command, files, &stats)
-			return
+			return fileOperator.executeDeleteTransaction(command, files, &stats)
 		}
 
-		total := 0
-
-		if command.IsBatch {
-			for _, file := range files {
-				count, err := fileOperator.deleteMatchesInBatch(file, command.Deletions)
-				if err != nil {
-					fileOperator.utils.printProcessingErrorMessage(file, err)
-					stats.Skipped++
-					continue
-				}
-				total += count
-				stats.Processed++
+		total := fileOperator.changeFiles(command, files, &stats, func(file string, limit *rowLimit) (int, error) {
+			if command.IsBatch {
+				return fileOperator.deleteMatchesInBatch(file, command.Deletions, limit)
 			}
+			return fileOperator.deleteMatches(file, command.Where, limit)
+		})
+
+		fmt.Printf("Deleted: %d lines\n", total)
+		fileOperator.utils.printStats(stats)
+		return stats.Skipped == 0
+	}
 
-			fmt.Printf("Deleted: %d lines\n", total)
-			fileOperator.utils.printStats(stats)
-			return
+	if command.Action == models.INSERT {
+		if dryRun {
+			return fileOperator.executeDryRun(command, files, useTransaction, stats)
 		}
 
-		for _, file := range files {
-			count, err := fileOperator.deleteMatches(file, command.Pattern)
-			if err != nil {
-				fileOperator.utils.printProcessingErrorMessage(file, err)
-				stats.Skipped++
-				continue
-			}
-			total += count
-			stats.Processed++
+		if useTransaction {
+			return fileOperator.executeInsertTransaction(command, files, &stats)
 		}
 
-		fmt.Printf("Deleted: %d lines\n", total)
+		total := fileOperator.changeFiles(command, files, &stats, func(file string, limit *rowLimit) (int, error) {
+			return fileOperator.insertIntoFile(file, command, limit)
+		})
+
+		fmt.Printf("Inserted: %d lines\n", total)
 		fileOperator.utils.printStats(stats)
 	}
+
+	return stats.Skipped == 0
 }
 
-func (fileOperator *FileOperator) executeDryRun(command models.Command, files []string, useTransaction bool, stats models.ExecutionStats) {
-	isValid := fileOperator.dryRunner.Validate(command, files, &stats, useTransaction)
-	status := "fail"
-	if isValid {
-		status = "pass"
+// ExecuteSelect runs a SELECT or COUNT while fileFinder walks the tree, so
+// that a LIMIT stops the walk as soon as enough rows have been printed. It
+// returns false when no file matched the pattern.
+func (fileOperator *FileOperator) ExecuteSelect(command models.Command, fileFinder *FileFinder) bool {
+	stats := models.ExecutionStats{StartTime: time.Now()}
+	walk := func(visit func(file string) bool) {
+		fileFinder.WalkSources(command.Sources, command.Excludes, visit)
 	}
 
-	fmt.Printf("Dry run: %s\n", status)
+	if command.Action == models.COUNT {
+		total := fileOperator.countFiles(command, walk, &stats)
+		if stats.Processed+stats.Skipped == 0 {
+			return false
+		}
+
+		fmt.Printf("%d lines matched\n", total)
+		fileOperator.utils.printStats(stats)
+		return true
+	}
+
+	fileOperator.selectFiles(command, walk, &stats)
+	if stats.Processed+stats.Skipped == 0 {
+		return false
+	}
+
+	fileOperator.utils.printStats(stats)
+	return true
 }
 
-func (fileOperator *FileOperator) countMatches(filename string, pattern *regexp.Regexp) (int, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return 0, err
+// selectFiles prints rows as soon as they are found, or only once every file
+// has been read when they have to be grouped or sorted first.
+func (fileOperator *FileOperator) selectFiles(command models.Command, walk func(visit func(file string) bool), stats *models.ExecutionStats) {
+	limit := newRowLimit(command)
+	printOutput := func(output string) bool {
+		if limit.take() {
+			fmt.Println(output)
+		}
+		return !limit.done()
 	}
 
-	lines := strings.Split(string(data), "\n")
-	count := 0
+	var rowSorter *RowSorter
+	var sortErr error
+	if len(command.OrderBy) > 0 {
+		rowSorter = NewRowSorter(command.OrderBy, MAX_SORT_ROWS_IN_MEMORY)
+	}
 
-	for _, line := range lines {
-		if pattern.MatchString(line) {
-			count++
+	seen := make(map[string]bool)
+	emitResult := func(row models.Row) bool {
+		output := fileOperator.formatRow(row, command.Columns)
+		if command.Distinct {
+			if seen[output] {
+				return true
+			}
+			seen[output] = true
+		}
+
+		if rowSorter == nil {
+			return printOutput(output)
 		}
+
+		sortErr = rowSorter.Add(row, output)
+		return sortErr == nil
 	}
 
-	return count, nil
-}
+	emit := emitResult
+	var rowGrouper *RowGrouper
+	if command.IsGrouped {
+		rowGrouper = NewRowGrouper(command.GroupBy, command.Aggregates)
+		emit = func(row models.Row) bool {
+			rowGrouper.Add(row)
+			return true
+		}
+	}
 
-func (fileOperator *FileOperator) selectMatches(filename string, pattern *regexp.Regexp) error {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return err
+	// Without sorting, grouping or DISTINCT no file can print more rows than
+	// the LIMIT and OFFSET let through, so reading a file stops there.
+	maxRows := -1
+	if command.HasLimit && rowSorter == nil && !command.IsGrouped && !command.Distinct {
+		maxRows = command.Offset + command.Limit
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for i, line := range lines {
-		if pattern.MatchString(line) {
-			fmt.Printf("%s:%d: %s\n", filename, i+1, line)
+	fileOperator.filePool.Stream(walk, func(file string, send func(row models.Row) bool) models.FileResult {
+		found := 0
+		err := fileOperator.selectMatches(file, command.Where, func(row models.Row) bool {
+			found++
+			return send(row) && (maxRows < 0 || found < maxRows)
+		})
+		return models.FileResult{Count: found, Err: err}
+	}, emit, func(file string, result models.FileResult) bool {
+		if result.Err != nil {
+			fileOperator.utils.printProcessingErrorMessage(file, result.Err)
+			stats.Skipped++
+			return true
 		}
+
+		stats.Processed++
+		return !limit.done() && sortErr == nil
+	})
+
+	if rowGrouper != nil && sortErr == nil {
+		rowGrouper.Each(func(row models.Row) bool {
+			if command.Having != nil && !fileOperator.predicateEvaluator.Matches(command.Having, row) {
+				return true
+			}
+			return emitResult(row)
+		})
 	}
 
-	return nil
-}
+	if rowSorter == nil {
+		return
+	}
 
-func (fileOperator *FileOperator) updateFile(filename string, pattern *regexp.Regexp, replace string) (int, error) {
-	if !fileOperator.utils.IsPathInsideCwd(filename) {
-		return 0, fmt.Errorf("invalid path detected: %s", filename)
+	if sortErr == nil {
+		sortErr = rowSorter.Each(printOutput)
 	}
 
-	if !fileOperator.utils.canWriteFile(filename) {
-		return 0, fmt.Errorf("permission denied")
+	if sortErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot sort results: %v\n", sortErr)
 	}
+}
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return 0, err
+// ExecuteScript runs commands in order and stops at the first statement whose
+// pattern matches no file. With useTransaction a script of several statements
+// commits or rolls back as a whole.
+func (fileOperator *FileOperator) ExecuteScript(commands []models.Command, fileFinder *FileFinder, useTransaction bool, dryRun bool) bool {
+	if len(commands) > 1 && useTransaction && !dryRun {
+		return fileOperator.executeScriptTransaction(commands, fileFinder)
 	}
 
-	lines := strings.Split(string(data), "\n")
-	count := 0
+	for _, command := range commands {
+		if command.Action == models.SELECT || command.Action == models.COUNT {
+			if !fileOperator.ExecuteSelect(command, fileFinder) {
+				fmt.Println("No files found")
+				return false
+			}
+			continue
+		}
 
-	for i, line := range lines {
-		if pattern.MatchString(line) {
-			lines[i] = pattern.ReplaceAllLiteralString(line, replace)
-			count++
+		files := fileFinder.FindSources(command.Sources, command.Excludes)
+		if len(files) == 0 {
+			fmt.Println("No files found")
+			return false
 		}
-	}
 
-	if count > 0 {
-		err = os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644)
-		if err != nil {
-			return 0, err
+		if !fileOperator.ExecuteCommand(command, files, useTransaction, dryRun) {
+			return false
 		}
 	}
 
-	return count, nil
+	return true
 }
 
-func (fileOperator *FileOperator) updateFileInBatch(filename string, replacements []models.Replacement) (int, error) {
-	if !fileOperator.utils.IsPathInsideCwd(filename) {
-		return 0, fmt.Errorf("invalid path detected: %s", filename)
-	}
+// executeScriptTransaction copies every file aside before the first statement
+// that may change it, and restores all the copies when a statement fails.
+func (fileOperator *FileOperator) executeScriptTransaction(commands []models.Command, fileFinder *FileFinder) bool {
+	var backups []fileBackup
+	backedUp := make(map[string]bool)
 
-	if !fileOperator.utils.canWriteFile(filename) {
-		return 0, fmt.Errorf("permission denied")
+	fail := func(format string, arguments ...any) bool {
+		fmt.Fprintf(os.Stderr, "Transaction failed: "+format+"\n", arguments...)
+		fileOperator.rollbackFiles(backups)
+		return false
 	}
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return 0, err
-	}
+	for _, command := range commands {
+		if command.Action == models.SELECT || command.Action == models.COUNT {
+			if !fileOperator.ExecuteSelect(command, fileFinder) {
+				return fail("no files found for %s", strings.Join(command.Sources, ", "))
+			}
+			continue
+		}
 
-	lines := strings.Split(string(data), "\n")
-	count := 0
+		files := fileFinder.FindSources(command.Sources, command.Excludes)
+		if len(files) == 0 {
+			return fail("no files found for %s", strings.Join(command.Sources, ", "))
+		}
 
-	for i, line := range lines {
-		for _, replacement := range replacements {
-			if replacement.Pattern.MatchString(line) {
-				lines[i] = replacement.Pattern.ReplaceAllLiteralString(line, replacement.Replace)
-				count++
-				break
+		for _, file := range files {
+			if backedUp[file] {
+				continue
+			}
+
+			if !fileOperator.utils.IsPathInsideCwd(file) {
+				return fail("invalid path %s", file)
+			}
+			if !fileOperator.utils.canWriteFile(file) {
+				return fail("cannot write %s", file)
 			}
+
+			backupPath := file + BACKUP_SUFFIX
+			if err := fileOperator.utils.copyFile(file, backupPath); err != nil {
+				return fail("%v", err)
+			}
+			backups = append(backups, fileBackup{original: file, backup: backupPath})
+			backedUp[file] = true
+		}
+
+		if !fileOperator.ExecuteCommand(command, files, false, false) {
+			return fail("%s on %s did not complete", command.Action, strings.Join(command.Sources, ", "))
 		}
 	}
 
-	if count > 0 {
-		err = os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644)
-		if err != nil {
-			return 0, err
+	for _, backup := range backups {
+		os.Remove(backup.backup)
+	}
+
+	return true
+}
+
+// countFiles adds up the matching lines of every file walk visits.
+func (fileOperator *FileOperator) countFiles(command models.Command, walk func(visit func(file string) bool), stats *models.ExecutionStats) int {
+	total := 0
+	fileOperator.filePool.Run(walk, func(file string) models.FileResult {
+		count, err := fileOperator.countMatches(file, command.Where)
+		return models.FileResult{Count: count, Err: err}
+	}, func(file string, result models.FileResult) bool {
+		if result.Err != nil {
+			fileOperator.utils.printProcessingErrorMessage(file, result.Err)
+			stats.Skipped++
+			return true
 		}
+
+		total += result.Count
+		stats.Processed++
+		return true
+	})
+
+	return total
+}
+
+// changeFiles applies change to files and returns the number of changed
+// lines. A LIMIT depends on how many lines the earlier files used up, so a
+// command with one changes its files one at a time.
+func (fileOperator *FileOperator) changeFiles(command models.Command, files []string, stats *models.ExecutionStats, change func(file string, limit *rowLimit) (int, error)) int {
+	filePool := fileOperator.filePool
+	if command.HasLimit {
+		filePool = NewFilePool(1)
 	}
 
-	return count, nil
+	total := 0
+	limit := newRowLimit(command)
+	filePool.Run(walkList(files), func(file string) models.FileResult {
+		count, err := change(file, limit)
+		return models.FileResult{Count: count, Err: err}
+	}, func(file string, result models.FileResult) bool {
+		if result.Err != nil {
+			fileOperator.utils.printProcessingErrorMessage(file, result.Err)
+			stats.Skipped++
+			return true
+		}
+
+		total += result.Count
+		stats.Processed++
+		return !limit.done()
+	})
+
+	return total
 }
 
-func (fileOperator *FileOperator) deleteMatches(filename string, pattern *regexp.Regexp) (int, error) {
-	if !fileOperator.utils.IsPathInsideCwd(filename) {
-		return 0, fmt.Errorf("invalid path detected: %s", filename)
+// walkList walks a list of files that was found beforehand.
+func walkList(files []string) func(visit func(file string) bool) {
+	return func(visit func(file string) bool) {
+		for _, file := range files {
+			if !visit(file) {
+				return
+			}
+		}
 	}
+}
 
-	if !fileOperator.utils.canWriteFile(filename) {
-		return 0, fmt.Errorf("permission denied")
+func (fileOperator *FileOperator) executeDryRun(command models.Command, files []string, useTransaction bool, stats models.ExecutionStats) bool {
+	isValid := fileOperator.dryRunner.Validate(command, files, &stats, useTransaction)
+	status := "fail"
+	if isValid {
+		status = "pass"
 	}
 
-	data, err := os.ReadFile(filename)
+	fmt.Printf("Dry run: %s\n", status)
+	return isValid
+}
+
+func (fileOperator *FileOperator) countMatches(filename string, where models.Predicate) (int, error) {
+	count := 0
+	err := fileOperator.lineReader.ReadRows(filename, fileOperator.logicalPath(filename), func(row models.Row) bool {
+		if fileOperator.predicateEvaluator.Matches(where, row) {
+			count++
+		}
+		return true
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	filtered := []string{}
-	count := 0
+	return count, nil
+}
 
-	for _, line := range lines {
-		if !pattern.MatchString(line) {
-			filtered = append(filtered, line)
-			continue
+// selectMatches passes every matching row to emit until emit returns false.
+func (fileOperator *FileOperator) selectMatches(filename string, where models.Predicate, emit func(row models.Row) bool) error {
+	return fileOperator.lineReader.ReadRows(filename, fileOperator.logicalPath(filename), func(row models.Row) bool {
+		if !fileOperator.predicateEvaluator.Matches(where, row) {
+			return true
 		}
-		count++
+
+		return emit(row)
+	})
+}
+
+// formatRow prints the SELECT columns of row separated by tabs, or the legacy
+// "path:line: content" for SELECT *.
+func (fileOperator *FileOperator) formatRow(row models.Row, columns []models.Operand) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("%s:%d: %s", row.Path, row.Line, row.Content)
 	}
 
-	if count > 0 {
-		err = os.WriteFile(filename, []byte(strings.Join(filtered, "\n")), 0644)
-		if err != nil {
-			return 0, err
-		}
+	values := make([]string, len(columns))
+	for index, column := range columns {
+		values[index] = fileOperator.predicateEvaluator.Evaluate(column, row).Text
 	}
 
-	return count, nil
+	return strings.Join(values, "\t")
 }
 
-func (fileOperator *FileOperator) deleteMatchesInBatch(filename string, deletions []models.Deletion) (int, error) {
-	if !fileOperator.utils.IsPathInsideCwd(filename) {
-		return 0, fmt.Errorf("invalid path detected: %s", filename)
+func (fileOperator *FileOperator) updateFile(filename string, where models.Predicate, pattern *regexp.Regexp, replace models.Operand, expand bool, limit *rowLimit) (int, error) {
+	if err := fileOperator.checkWritable(filename); err != nil {
+		return 0, err
 	}
 
-	if !fileOperator.utils.canWriteFile(filename) {
-		return 0, fmt.Errorf("permission denied")
+	return fileOperator.rewriteRows(filename, func(row models.Row, write func(line string)) bool {
+		line := row.Content
+		if fileOperator.predicateEvaluator.Matches(where, row) && limit.take() {
+			value := fileOperator.predicateEvaluator.Evaluate(replace, row)
+			line = fileOperator.utils.replaceLine(line, pattern, value.Text, expand)
+		}
+
+		write(line)
+		return line != row.Content
+	})
+}
+
+func (fileOperator *FileOperator) updateFileInBatch(filename string, replacements []models.Replacement, limit *rowLimit) (int, error) {
+	if err := fileOperator.checkWritable(filename); err != nil {
+		return 0, err
 	}
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
+	return fileOperator.rewriteRows(filename, func(row models.Row, write func(line string)) bool {
+		line := row.Content
+		for _, replacement := range replacements {
+			if fileOperator.predicateEvaluator.Matches(replacement.Where, row) {
+				if limit.take() {
+					value := fileOperator.predicateEvaluator.Evaluate(replacement.Replace, row)
+					line = fileOperator.utils.replaceLine(line, replacement.Pattern, value.Text, replacement.Expand)
+				}
+				break
+			}
+		}
+
+		write(line)
+		return line != row.Content
+	})
+}
+
+func (fileOperator *FileOperator) deleteMatches(filename string, where models.Predicate, limit *rowLimit) (int, error) {
+	if err := fileOperator.checkWritable(filename); err != nil {
 		return 0, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	filtered := []string{}
-	count := 0
+	return fileOperator.rewriteRows(filename, func(row models.Row, write func(line string)) bool {
+		if fileOperator.predicateEvaluator.Matches(where, row) && limit.take() {
+			return true
+		}
 
-	for _, line := range lines {
-		shouldDelete := false
+		write(row.Content)
+		return false
+	})
+}
 
+func (fileOperator *FileOperator) deleteMatchesInBatch(filename string, deletions []models.Deletion, limit *rowLimit) (int, error) {
+	if err := fileOperator.checkWritable(filename); err != nil {
+		return 0, err
+	}
+
+	return fileOperator.rewriteRows(filename, func(row models.Row, write func(line string)) bool {
 		for _, deletion := range deletions {
-			if deletion.Pattern.MatchString(line) {
-				shouldDelete = true
-				count++
+			if fileOperator.predicateEvaluator.Matches(deletion.Where, row) {
+				if limit.take() {
+					return true
+				}
 				break
 			}
 		}
 
-		if !shouldDelete {
-			filtered = append(filtered, line)
-		}
+		write(row.Content)
+		return false
+	})
+}
+
+func (fileOperator *FileOperator) insertIntoFile(filename string, command models.Command, limit *rowLimit) (int, error) {
+	if err := fileOperator.checkWritable(filename); err != nil {
+		return 0, err
 	}
 
-	if count > 0 {
-		err = os.WriteFile(filename, []byte(strings.Join(filtered, "\n")), 0644)
-		if err != nil {
-			return 0, err
-		}
+	count := 0
+	err := fileOperator.fileRewriter.Rewrite(filename, func(input io.Reader, info os.FileInfo, write func(line string)) (bool, error) {
+		var err error
+		count, err = fileOperator.lineInserter.Insert(input, fileOperator.logicalPath(filename), info, command, limit.take, write)
+		return count > 0, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (fileOperator *FileOperator) checkWritable(filename string) error {
+	if !fileOperator.utils.IsPathInsideCwd(filename) {
+		return fmt.Errorf("invalid path detected: %s", filename)
+	}
+
+	if !fileOperator.utils.canWriteFile(filename) {
+		return fmt.Errorf("permission denied")
+	}
+
+	return nil
+}
+
+// rewriteRows streams the rows of filename through edit, which writes what
+// takes the place of each row and reports whether the row changed. The file
+// is only replaced when a row changed, and the changed rows are counted.
+func (fileOperator *FileOperator) rewriteRows(filename string, edit func(row models.Row, write func(line string)) bool) (int, error) {
+	count := 0
+	err := fileOperator.fileRewriter.Rewrite(filename, func(input io.Reader, info os.FileInfo, write func(line string)) (bool, error) {
+		err := fileOperator.lineReader.Rows(input, fileOperator.logicalPath(filename), info, func(row models.Row) bool {
+			if edit(row, write) {
+				count++
+			}
+			return true
+		})
+		return count > 0, err
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return count, nil
 }
 
+// logicalPath maps the backup a transaction edits back to the file the user
+// asked for, so that path columns never see the backup suffix.
+func (fileOperator *FileOperator) logicalPath(filename string) string {
+	return strings.TrimSuffix(filename, BACKUP_SUFFIX)
+}
+
 func (fileOperator *FileOperator) checkFilesBeforeTransaction(files []string) {
 	for _, file := range files {
 		if !fileOperator.utils.IsPathInsideCwd(file) {
@@ -376,91 +628,91 @@ func (fileOperator *FileOperator) checkFilesBeforeTransaction(files []string) {
 	}
 }
 
-func (fileOperator *FileOperator) executeUpdateTransaction(command models.Command, files []string, stats *models.ExecutionStats) {
-	fileOperator.checkFilesBeforeTransaction(files)
-
-	backups := make([]fileBackup, 0, len(files))
-	total := 0
-
-	for _, file := range files {
-		backupPath := file + ".sqd_backup"
-		if err := os.Rename(file, backupPath); err != nil {
-			fileOperator.rollbackFiles(backups)
-			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
+func (fileOperator *FileOperator) executeUpdateTransaction(command models.Command, files []string, stats *models.ExecutionStats) bool {
+	total, ok := fileOperator.executeTransaction(command, files, stats, func(backupPath string, limit *rowLimit) (int, error) {
+		if command.IsBatch {
+			return fileOperator.updateFileInBatch(backupPath, command.Replacements, limit)
 		}
-		backups = append(backups, fileBackup{original: file, backup: backupPath})
+		return fileOperator.updateFile(backupPath, command.Where, command.Pattern, command.Replace, command.Expand, limit)
+	})
+	if !ok {
+		return false
+	}
 
-		var count int
-		var err error
+	fileOperator.utils.printUpdateMessage(total)
+	fileOperator.utils.printStats(*stats)
+	return true
+}
 
+func (fileOperator *FileOperator) executeDeleteTransaction(command models.Command, files []string, stats *models.ExecutionStats) bool {
+	total, ok := fileOperator.executeTransaction(command, files, stats, func(backupPath string, limit *rowLimit) (int, error) {
 		if command.IsBatch {
-			count, err = fileOperator.updateFileInBatch(backupPath, command.Replacements)
-		} else {
-			count, err = fileOperator.updateFile(backupPath, command.Pattern, command.Replace)
-		}
-
-		if err != nil {
-			fileOperator.rollbackFiles(backups)
-			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
+			return fileOperator.deleteMatchesInBatch(backupPath, command.Deletions, limit)
 		}
+		return fileOperator.deleteMatches(backupPath, command.Where, limit)
+	})
+	if !ok {
+		return false
+	}
 
-		if err := os.Rename(backupPath, file); err != nil {
-			fileOperator.rollbackFiles(backups)
-			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
-		}
+	fmt.Printf("Deleted: %d lines\n", total)
+	fileOperator.utils.printStats(*stats)
+	return true
+}
 
-		total += count
-		stats.Processed++
+func (fileOperator *FileOperator) executeInsertTransaction(command models.Command, files []string, stats *models.ExecutionStats) bool {
+	total, ok := fileOperator.executeTransaction(command, files, stats, func(backupPath string, limit *rowLimit) (int, error) {
+		return fileOperator.insertIntoFile(backupPath, command, limit)
+	})
+	if !ok {
+		return false
 	}
 
-	fileOperator.utils.printUpdateMessage(total)
+	fmt.Printf("Inserted: %d lines\n", total)
 	fileOperator.utils.printStats(*stats)
+	return true
 }
 
-func (fileOperator *FileOperator) executeDeleteTransaction(command models.Command, files []string, stats *models.ExecutionStats) {
+// executeTransaction moves each file to a backup, lets apply edit the backup
+// and moves it back, rolling every file back as soon as one of them fails.
+func (fileOperator *FileOperator) executeTransaction(command models.Command, files []string, stats *models.ExecutionStats, apply func(backupPath string, limit *rowLimit) (int, error)) (int, bool) {
 	fileOperator.checkFilesBeforeTransaction(files)
+
 	backups := make([]fileBackup, 0, len(files))
 	total := 0
+	limit := newRowLimit(command)
 
 	for _, file := range files {
-		backupPath := file + ".sqd_backup"
+		if limit.done() {
+			break
+		}
+
+		backupPath := file + BACKUP_SUFFIX
 		if err := os.Rename(file, backupPath); err != nil {
 			fileOperator.rollbackFiles(backups)
 			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
+			return 0, false
 		}
 		backups = append(backups, fileBackup{original: file, backup: backupPath})
 
-		var count int
-		var err error
-
-		if command.IsBatch {
-			count, err = fileOperator.deleteMatchesInBatch(backupPath, command.Deletions)
-		} else {
-			count, err = fileOperator.deleteMatches(backupPath, command.Pattern)
-		}
-
+		count, err := apply(backupPath, limit)
 		if err != nil {
 			fileOperator.rollbackFiles(backups)
 			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
+			return 0, false
 		}
 
 		if err := os.Rename(backupPath, file); err != nil {
 			fileOperator.rollbackFiles(backups)
 			fmt.Fprintf(os.Stderr, "Transaction failed: %v\n", err)
-			return
+			return 0, false
 		}
 
 		total += count
 		stats.Processed++
 	}
 
-	fmt.Printf("Deleted: %d lines\n", total)
-	fileOperator.utils.printStats(*stats)
+	return total, true
 }
 
 func (fileOperator *FileOperator) rollbackFiles(backups []fileBackup) {
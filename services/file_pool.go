@@ -0,0 +1,127 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+// MAX_ROWS_AHEAD_PER_FILE is how many rows a file that is not yet at the head
+// of the queue may buffer before its worker waits for its turn.
+const MAX_ROWS_AHEAD_PER_FILE = 1024
+
+// FilePool processes several files at once while they are still being
+// discovered, and hands the results back in the order the files were found.
+type FilePool struct {
+	workers int
+}
+
+func NewFilePool(workers int) *FilePool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &FilePool{workers: workers}
+}
+
+// Run calls process for every file walk visits and collect for each result in
+// walk order, until the walk ends or collect returns false. With a single
+// worker everything runs on the calling goroutine, one file at a time.
+func (filePool *FilePool) Run(walk func(visit func(file string) bool), process func(file string) models.FileResult, collect func(file string, result models.FileResult) bool) {
+	filePool.Stream(walk, func(file string, send func(row models.Row) bool) models.FileResult {
+		return process(file)
+	}, nil, collect)
+}
+
+// Stream is Run for a process that sends rows: collectRow gets the rows of the
+// file at the head of the queue as soon as they are sent, files further back
+// wait for their turn. When collectRow returns false process is told to stop,
+// collect still gets the result of that file and nothing else runs after it.
+func (filePool *FilePool) Stream(walk func(visit func(file string) bool), process func(file string, send func(row models.Row) bool) models.FileResult, collectRow func(row models.Row) bool, collect func(file string, result models.FileResult) bool) {
+	if filePool.workers == 1 {
+		walk(func(file string) bool {
+			stopped := false
+			result := process(file, func(row models.Row) bool {
+				stopped = !collectRow(row)
+				return !stopped
+			})
+			return collect(file, result) && !stopped
+		})
+		return
+	}
+
+	type job struct {
+		file   string
+		rows   chan models.Row
+		result chan models.FileResult
+	}
+
+	jobs := make(chan job)
+	pending := make(chan job, filePool.workers)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+
+		walk(func(file string) bool {
+			next := job{
+				file:   file,
+				rows:   make(chan models.Row, MAX_ROWS_AHEAD_PER_FILE),
+				result: make(chan models.FileResult, 1),
+			}
+
+			select {
+			case pending <- next:
+			case <-done:
+				return false
+			}
+
+			select {
+			case jobs <- next:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+
+	var workers sync.WaitGroup
+	for range filePool.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for next := range jobs {
+				result := process(next.file, func(row models.Row) bool {
+					select {
+					case next.rows <- row:
+						return true
+					case <-done:
+						return false
+					}
+				})
+				close(next.rows)
+				next.result <- result
+			}
+		}()
+	}
+
+	for next := range pending {
+		stopped := false
+		for row := range next.rows {
+			if !stopped && !collectRow(row) {
+				stopped = true
+				close(done)
+			}
+		}
+
+		if !collect(next.file, <-next.result) || stopped {
+			if !stopped {
+				close(done)
+			}
+			break
+		}
+	}
+
+	workers.Wait()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const TEMP_SUFFIX = ".sqd_tmp"
+
+// FileRewriter edits a file by streaming it into a temporary file next to it,
+// which then replaces the original. The file is never held in memory, and it
+// is never left half written when an edit fails.
+type FileRewriter struct{}
+
+func NewFileRewriter() *FileRewriter {
+	return &FileRewriter{}
+}
+
+// Rewrite hands the content of path to rewrite, which passes every line of
+// the new content to write. The new content only replaces path when rewrite
+// reports that it changed something.
+func (fileRewriter *FileRewriter) Rewrite(path string, rewrite func(input io.Reader, info os.FileInfo, write func(line string)) (bool, error)) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	input, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	output, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*"+TEMP_SUFFIX)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			output.Close()
+			os.Remove(output.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(output)
+	first := true
+	changed, err := rewrite(input, info, func(line string) {
+		if !first {
+			writer.WriteByte('\n')
+		}
+		first = false
+		writer.WriteString(line)
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+	input.Close()
+
+	if err := os.Chmod(output.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(output.Name(), target); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
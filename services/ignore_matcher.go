@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IGNORE_FILES are read in every directory, later files taking precedence
+// over earlier ones.
+var IGNORE_FILES = []string{".gitignore", ".ignore", ".sqdignore"}
+
+type ignoreRule struct {
+	pattern       *regexp.Regexp
+	negated       bool
+	directoryOnly bool
+}
+
+// IgnoreMatcher applies the ignore files of every directory between the
+// current directory and a path with gitignore semantics: the last matching
+// rule wins, and rules of deeper directories come last.
+type IgnoreMatcher struct {
+	rules map[string][]ignoreRule
+}
+
+func NewIgnoreMatcher() *IgnoreMatcher {
+	return &IgnoreMatcher{rules: make(map[string][]ignoreRule)}
+}
+
+// IsIgnored only considers paths inside the current directory.
+func (ignoreMatcher *IgnoreMatcher) IsIgnored(path string, isDir bool) bool {
+	relativePath := filepath.Clean(path)
+	if filepath.IsAbs(relativePath) {
+		currentWorkingDir, err := os.Getwd()
+		if err != nil {
+			return false
+		}
+
+		relativePath, err = filepath.Rel(currentWorkingDir, relativePath)
+		if err != nil {
+			return false
+		}
+	}
+
+	relativePath = filepath.ToSlash(relativePath)
+	if relativePath == "." || relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+		return false
+	}
+
+	components := strings.Split(relativePath, "/")
+	ignored := false
+
+	for depth := range components {
+		dir := "."
+		if depth > 0 {
+			dir = strings.Join(components[:depth], "/")
+		}
+		pathInDir := strings.Join(components[depth:], "/")
+
+		for _, rule := range ignoreMatcher.loadRules(dir) {
+			if rule.directoryOnly && !isDir {
+				continue
+			}
+
+			if rule.pattern.MatchString(pathInDir) {
+				ignored = !rule.negated
+			}
+		}
+	}
+
+	return ignored
+}
+
+func (ignoreMatcher *IgnoreMatcher) loadRules(dir string) []ignoreRule {
+	if rules, ok := ignoreMatcher.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	for _, name := range IGNORE_FILES {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := ignoreMatcher.parseRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		file.Close()
+	}
+
+	ignoreMatcher.rules[dir] = rules
+	return rules
+}
+
+// parseRule reads one line of an ignore file. A leading ! re-includes what an
+// earlier rule excluded, a trailing / only matches directories, and any other
+// / anchors the pattern to the directory of the ignore file.
+func (ignoreMatcher *IgnoreMatcher) parseRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+
+	line = strings.TrimSuffix(line, "\r")
+	if strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line[:len(line)-2], " ") + `\ `
+	} else {
+		line = strings.TrimRight(line, " ")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negated = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.directoryOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") && !strings.HasPrefix(line, "/") && !strings.HasPrefix(line, "**/") {
+		line = "/" + line
+	}
+
+	pattern, err := globToRegex(strings.TrimPrefix(line, "/"), strings.HasPrefix(line, "/"), false)
+	if err != nil || line == "" {
+		return rule, false
+	}
+
+	rule.pattern = pattern
+	return rule, true
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+var keywords = map[string]bool{
+	"SELECT":   true,
+	"FROM":     true,
+	"EXCLUDE":  true,
+	"WHERE":    true,
+	"UPDATE":   true,
+	"SET":      true,
+	"DELETE":   true,
+	"INSERT":   true,
+	"INTO":     true,
+	"VALUES":   true,
+	"AT":       true,
+	"START":    true,
+	"AFTER":    true,
+	"BEFORE":   true,
+	"LIKE":     true,
+	"AND":      true,
+	"OR":       true,
+	"NOT":      true,
+	"REGEXP":   true,
+	"ILIKE":    true,
+	"ESCAPE":   true,
+	"BETWEEN":  true,
+	"AS":       true,
+	"LIMIT":    true,
+	"OFFSET":   true,
+	"ORDER":    true,
+	"GROUP":    true,
+	"HAVING":   true,
+	"DISTINCT": true,
+	"CASE":     true,
+	"WHEN":     true,
+	"THEN":     true,
+	"ELSE":     true,
+	"END":      true,
+	"BY":       true,
+	"ASC":      true,
+	"DESC":     true,
+}
+
+// operators is ordered so that two character operators are tried before
+// their one character prefixes.
+var operators = []models.TokenKind{
+	models.CONCAT,
+	models.NOT_TILDE,
+	models.NOT_EQUAL,
+	models.LESS_GREATER,
+	models.LESS_EQUAL,
+	models.GREATER_EQUAL,
+	models.STAR,
+	models.COMMA,
+	models.LEFT_PAREN,
+	models.RIGHT_PAREN,
+	models.EQUAL,
+	models.TILDE,
+	models.LESS,
+	models.GREATER,
+	models.MINUS,
+	models.SEMICOLON,
+}
+
+type Lexer struct {
+	input    string
+	position int
+}
+
+func NewLexer(input string) *Lexer {
+	return &Lexer{input: input}
+}
+
+func (lexer *Lexer) Next() models.Token {
+	lexer.skipWhitespace()
+
+	if lexer.position >= len(lexer.input) {
+		return lexer.newToken(models.EOF, "", lexer.position)
+	}
+
+	start := lexer.position
+	char := lexer.input[start]
+
+	switch {
+	case lexer.isEscapeString():
+		return lexer.scanString()
+	case isIdentStart(char):
+		return lexer.scanWord()
+	case isDigit(char):
+		return lexer.scanNumber()
+	case char == '\'' || char == '"':
+		return lexer.scanString()
+	case char == '?':
+		lexer.position++
+		return lexer.newToken(models.PARAMETER, "?", start)
+	case char == ':' && start+1 < len(lexer.input) && isIdentStart(lexer.input[start+1]):
+		lexer.position++
+		for lexer.position < len(lexer.input) && isIdentPart(lexer.input[lexer.position]) {
+			lexer.position++
+		}
+		return lexer.newToken(models.PARAMETER, lexer.input[start:lexer.position], start)
+	}
+
+	for _, operator := range operators {
+		if strings.HasPrefix(lexer.input[start:], string(operator)) {
+			lexer.position += len(operator)
+			return lexer.newToken(operator, string(operator), start)
+		}
+	}
+
+	lexer.position++
+	return lexer.newToken(models.ILLEGAL, string(char), start)
+}
+
+// NextPath scans a file pattern such as *.md or docs/notes.txt. Paths are not
+// regular tokens because they freely mix characters like '*', '.' and '/', so
+// the parser asks for one explicitly where a file pattern is expected.
+func (lexer *Lexer) NextPath() models.Token {
+	lexer.skipWhitespace()
+
+	if lexer.position >= len(lexer.input) {
+		return lexer.newToken(models.EOF, "", lexer.position)
+	}
+
+	if char := lexer.input[lexer.position]; char == '\'' || char == '"' || lexer.isEscapeString() {
+		return lexer.scanString()
+	}
+
+	// A comma inside braces separates glob alternatives, like src/{a,b}/*.go,
+	// only a comma outside them ends the path.
+	start := lexer.position
+	depth := 0
+	for lexer.position < len(lexer.input) {
+		char := lexer.input[lexer.position]
+		if char == '{' {
+			depth++
+		} else if char == '}' && depth > 0 {
+			depth--
+		} else if isPathTerminator(char) && (char != ',' || depth == 0) {
+			break
+		}
+		lexer.position++
+	}
+
+	return lexer.newToken(models.PATH, lexer.input[start:lexer.position], start)
+}
+
+func (lexer *Lexer) scanWord() models.Token {
+	start := lexer.position
+	for lexer.position < len(lexer.input) && isIdentPart(lexer.input[lexer.position]) {
+		lexer.position++
+	}
+
+	word := lexer.input[start:lexer.position]
+	upperWord := strings.ToUpper(word)
+	if keywords[upperWord] {
+		return lexer.newToken(models.KEYWORD, upperWord, start)
+	}
+
+	return lexer.newToken(models.IDENT, word, start)
+}
+
+func (lexer *Lexer) scanNumber() models.Token {
+	start := lexer.position
+	for lexer.position < len(lexer.input) && isDigit(lexer.input[lexer.position]) {
+		lexer.position++
+	}
+
+	if lexer.position+1 < len(lexer.input) && lexer.input[lexer.position] == '.' && isDigit(lexer.input[lexer.position+1]) {
+		lexer.position++
+		for lexer.position < len(lexer.input) && isDigit(lexer.input[lexer.position]) {
+			lexer.position++
+		}
+	}
+
+	return lexer.newToken(models.NUMBER, lexer.input[start:lexer.position], start)
+}
+
+// isEscapeString reports whether an E'...' string, where backslash escapes
+// are resolved, starts at the current position.
+func (lexer *Lexer) isEscapeString() bool {
+	position := lexer.position
+	if position+1 >= len(lexer.input) || (lexer.input[position] != 'E' && lexer.input[position] != 'e') {
+		return false
+	}
+
+	return lexer.input[position+1] == '\'' || lexer.input[position+1] == '"'
+}
+
+// scanString reads a string quoted with ' or ", where the quote is written
+// twice to include it. Backslashes are literal, except in E-strings.
+func (lexer *Lexer) scanString() models.Token {
+	start := lexer.position
+	escapes := lexer.isEscapeString()
+	if escapes {
+		lexer.position++
+	}
+
+	quote := lexer.input[lexer.position]
+	lexer.position++
+
+	var value strings.Builder
+	for lexer.position < len(lexer.input) {
+		char := lexer.input[lexer.position]
+
+		if escapes && char == '\\' && lexer.position+1 < len(lexer.input) {
+			value.WriteByte(unescape(lexer.input[lexer.position+1]))
+			lexer.position += 2
+			continue
+		}
+
+		if char == quote && lexer.position+1 < len(lexer.input) && lexer.input[lexer.position+1] == quote {
+			value.WriteByte(quote)
+			lexer.position += 2
+			continue
+		}
+
+		if char == quote {
+			lexer.position++
+			return lexer.newToken(models.STRING, value.String(), start)
+		}
+
+		value.WriteByte(char)
+		lexer.position++
+	}
+
+	return lexer.newToken(models.ILLEGAL, lexer.input[start:], start)
+}
+
+func (lexer *Lexer) newToken(kind models.TokenKind, value string, start int) models.Token {
+	lineStart := strings.LastIndexByte(lexer.input[:start], '\n') + 1
+
+	return models.Token{
+		Kind:     kind,
+		Value:    value,
+		Position: start,
+		Line:     strings.Count(lexer.input[:start], "\n") + 1,
+		Column:   utf8.RuneCountInString(lexer.input[lineStart:start]) + 1,
+	}
+}
+
+// skipWhitespace also skips comments, which run from -- or # to the end of
+// the line.
+func (lexer *Lexer) skipWhitespace() {
+	for lexer.position < len(lexer.input) {
+		rest := lexer.input[lexer.position:]
+		switch {
+		case isWhitespace(rest[0]):
+			lexer.position++
+		case rest[0] == '#' || strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			lexer.position += end
+		default:
+			return
+		}
+	}
+}
+
+func unescape(char byte) byte {
+	switch char {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	}
+
+	return char
+}
+
+func isWhitespace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
+}
+
+func isIdentStart(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func isIdentPart(char byte) bool {
+	return isIdentStart(char) || isDigit(char)
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isPathTerminator(char byte) bool {
+	return isWhitespace(char) || char == ',' || char == '(' || char == ')' || char == ';'
+}
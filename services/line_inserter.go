@@ -0,0 +1,85 @@
+package services
+
+import (
+	"io"
+	"os"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+// LineInserter adds the values of an INSERT to the lines of a file. A
+// trailing newline stays the last thing in the file, so AT END writes before
+// it and AFTER and BEFORE never match the empty string that follows it.
+type LineInserter struct {
+	predicateEvaluator *PredicateEvaluator
+	lineReader         *LineReader
+}
+
+func NewLineInserter() *LineInserter {
+	return &LineInserter{predicateEvaluator: NewPredicateEvaluator(), lineReader: NewLineReader()}
+}
+
+// Insert streams the lines of input to write with the new lines added, and
+// returns how many lines were added. take is asked once per insertion point,
+// and no line is added where it returns false.
+func (lineInserter *LineInserter) Insert(input io.Reader, path string, info os.FileInfo, command models.Command, take func() bool, write func(line string)) (int, error) {
+	count := 0
+	insert := func(row models.Row) {
+		for _, value := range command.Values {
+			write(lineInserter.predicateEvaluator.Evaluate(value, row).Text)
+			count++
+		}
+	}
+
+	writeLine := func(row models.Row) {
+		if command.Position == models.INSERT_AT_START || command.Position == models.INSERT_AT_END {
+			write(row.Content)
+			return
+		}
+
+		matched := lineInserter.predicateEvaluator.Matches(command.Where, row) && take()
+		if matched && command.Position == models.INSERT_BEFORE {
+			insert(row)
+		}
+		write(row.Content)
+		if matched && command.Position == models.INSERT_AFTER {
+			insert(row)
+		}
+	}
+
+	if command.Position == models.INSERT_AT_START && take() {
+		insert(models.Row{Path: path, Info: info})
+	}
+
+	// Every line is held back until the next one is read, because the last
+	// line is only written by the caller when it is not the trailing newline.
+	var previous models.Row
+	err := lineInserter.lineReader.Rows(input, path, info, func(row models.Row) bool {
+		if previous.Line > 0 {
+			writeLine(previous)
+		}
+		previous = row
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	trailingNewline := previous.Content == ""
+	lines := previous.Line
+	if trailingNewline {
+		lines--
+	} else {
+		writeLine(previous)
+	}
+
+	if command.Position == models.INSERT_AT_END && take() {
+		insert(models.Row{Path: path, Info: info, Line: lines + 1})
+	}
+
+	if trailingNewline {
+		write("")
+	}
+
+	return count, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+// LineReader streams the lines of a file instead of loading it whole. Lines
+// are split on \n the way strings.Split splits them: a file that ends with a
+// newline has an empty last line, and an empty file has a single one.
+type LineReader struct{}
+
+func NewLineReader() *LineReader {
+	return &LineReader{}
+}
+
+// Each calls visit with every line of reader until visit returns false.
+func (lineReader *LineReader) Each(reader io.Reader, visit func(line string) bool) error {
+	buffered := bufio.NewReader(reader)
+
+	for {
+		line, err := buffered.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err == io.EOF {
+			visit(line)
+			return nil
+		}
+
+		if !visit(line[:len(line)-1]) {
+			return nil
+		}
+	}
+}
+
+// Rows calls visit with a row for every line of reader, numbered from 1.
+func (lineReader *LineReader) Rows(reader io.Reader, path string, info os.FileInfo, visit func(row models.Row) bool) error {
+	number := 0
+
+	return lineReader.Each(reader, func(line string) bool {
+		number++
+		return visit(models.Row{Path: path, Info: info, Line: number, Content: line})
+	})
+}
+
+// ReadRows opens filename and streams its rows, which report path as their
+// path.
+func (lineReader *LineReader) ReadRows(filename string, path string, visit func(row models.Row) bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return lineReader.Rows(file, path, info, visit)
+}
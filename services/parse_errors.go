@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+func newParseError(token models.Token, message string) *models.ParseError {
+	return &models.ParseError{
+		Message:  message,
+		Found:    describeToken(token),
+		Position: token.Position,
+		Line:     token.Line,
+		Column:   token.Column,
+	}
+}
+
+func newUnexpectedTokenError(token models.Token, expected ...string) *models.ParseError {
+	if token.Kind == models.ILLEGAL && strings.IndexAny(strings.TrimLeft(token.Value, "Ee"), `'"`) == 0 {
+		return newParseError(token, "unterminated string literal")
+	}
+
+	parseError := newParseError(token, "unexpected "+describeToken(token))
+	parseError.Expected = expected
+
+	if token.Kind == models.IDENT || token.Kind == models.KEYWORD || token.Kind == models.PATH {
+		parseError.Suggestion = closestMatch(token.Value, expected)
+	}
+
+	return parseError
+}
+
+func describeToken(token models.Token) string {
+	switch token.Kind {
+	case models.EOF:
+		return "end of query"
+	case models.STRING:
+		return fmt.Sprintf("string '%s'", token.Value)
+	}
+
+	return fmt.Sprintf("%q", token.Value)
+}
+
+func describeKind(kind models.TokenKind) string {
+	switch kind {
+	case models.IDENT:
+		return "identifier"
+	case models.STRING:
+		return "string literal"
+	case models.NUMBER:
+		return "number"
+	case models.PATH:
+		return "file pattern"
+	case models.PARAMETER:
+		return "parameter"
+	case models.EOF:
+		return "end of query"
+	}
+
+	return "'" + string(kind) + "'"
+}
+
+// closestMatch returns the candidate that is a small typo away from word, or
+// an empty string when none is close enough to be a useful hint.
+func closestMatch(word string, candidates []string) string {
+	best := ""
+	bestDistance := 3
+
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToUpper(word), strings.ToUpper(candidate))
+		if distance < bestDistance && distance < len(candidate) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// editDistance is the optimal string alignment distance, so that swapping two
+// adjacent characters (FORM for FROM) counts as a single edit.
+func editDistance(first, second string) int {
+	a := []rune(first)
+	b := []rune(second)
+	distances := make([][]int, len(a)+1)
+
+	for i := range distances {
+		distances[i] = make([]int, len(b)+1)
+		distances[i][0] = i
+	}
+
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			distances[i][j] = min(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				distances[i][j] = min(distances[i][j], distances[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return distances[len(a)][len(b)]
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+const MTIME_LAYOUT = "2006-01-02 15:04:05"
+
+type PredicateEvaluator struct{}
+
+func NewPredicateEvaluator() *PredicateEvaluator {
+	return &PredicateEvaluator{}
+}
+
+func (predicateEvaluator *PredicateEvaluator) Matches(predicate models.Predicate, row models.Row) bool {
+	switch predicate := predicate.(type) {
+	case *models.AndPredicate:
+		return predicateEvaluator.Matches(predicate.Left, row) && predicateEvaluator.Matches(predicate.Right, row)
+	case *models.OrPredicate:
+		return predicateEvaluator.Matches(predicate.Left, row) || predicateEvaluator.Matches(predicate.Right, row)
+	case *models.NotPredicate:
+		return !predicateEvaluator.Matches(predicate.Operand, row)
+	case *models.PatternPredicate:
+		return predicate.Pattern.MatchString(predicateEvaluator.Evaluate(predicate.Operand, row).Text)
+	case *models.TruePredicate:
+		return true
+	case *models.ComparisonPredicate:
+		left := predicateEvaluator.Evaluate(predicate.Left, row)
+		right := predicateEvaluator.Evaluate(predicate.Right, row)
+		return predicateEvaluator.satisfies(predicate.Operator, predicateEvaluator.compare(left, right))
+	}
+
+	return false
+}
+
+func (predicateEvaluator *PredicateEvaluator) Evaluate(operand models.Operand, row models.Row) models.Value {
+	switch operand := operand.(type) {
+	case *models.ColumnOperand:
+		return predicateEvaluator.evaluateColumn(operand.Column, row)
+	case *models.LiteralOperand:
+		return operand.Value
+	case *models.FunctionOperand:
+		arguments := make([]models.Value, len(operand.Arguments))
+		for index, argument := range operand.Arguments {
+			arguments[index] = predicateEvaluator.Evaluate(argument, row)
+		}
+		return scalarFunctions[operand.Name].apply(arguments)
+	case *models.CaseOperand:
+		for _, when := range operand.Whens {
+			if predicateEvaluator.Matches(when.Condition, row) {
+				return predicateEvaluator.Evaluate(when.Result, row)
+			}
+		}
+
+		if operand.Else != nil {
+			return predicateEvaluator.Evaluate(operand.Else, row)
+		}
+	case *models.AggregateOperand:
+		if operand.Index < len(row.Aggregates) {
+			return row.Aggregates[operand.Index]
+		}
+	}
+
+	return models.Value{}
+}
+
+// mtime is formatted as "2006-01-02 15:04:05" in local time so that it can be
+// compared with date literals such as '2026-01-01' as plain text.
+func (predicateEvaluator *PredicateEvaluator) evaluateColumn(column models.Column, row models.Row) models.Value {
+	path := filepath.ToSlash(row.Path)
+
+	switch column {
+	case models.CONTENT_COLUMN:
+		return models.Value{Text: row.Content}
+	case models.LINE_COLUMN:
+		return numberValue(int64(row.Line))
+	case models.PATH_COLUMN:
+		return models.Value{Text: path}
+	case models.FILENAME_COLUMN:
+		return models.Value{Text: filepath.Base(row.Path)}
+	case models.EXT_COLUMN:
+		return models.Value{Text: strings.TrimPrefix(filepath.Ext(row.Path), ".")}
+	case models.DIR_COLUMN:
+		return models.Value{Text: filepath.ToSlash(filepath.Dir(row.Path))}
+	case models.SIZE_COLUMN:
+		if row.Info == nil {
+			return models.Value{}
+		}
+		return numberValue(row.Info.Size())
+	case models.MTIME_COLUMN:
+		if row.Info == nil {
+			return models.Value{}
+		}
+		return models.Value{Text: row.Info.ModTime().Format(MTIME_LAYOUT)}
+	}
+
+	return models.Value{}
+}
+
+// compare orders two values numerically when one of them is a number and the
+// other one can be read as a number, and as text otherwise.
+func (predicateEvaluator *PredicateEvaluator) compare(left models.Value, right models.Value) int {
+	if left.IsNumber || right.IsNumber {
+		leftNumber, leftOk := toNumber(left)
+		rightNumber, rightOk := toNumber(right)
+
+		if leftOk && rightOk {
+			switch {
+			case leftNumber < rightNumber:
+				return -1
+			case leftNumber > rightNumber:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(left.Text, right.Text)
+}
+
+func (predicateEvaluator *PredicateEvaluator) satisfies(operator models.TokenKind, comparison int) bool {
+	switch operator {
+	case models.EQUAL:
+		return comparison == 0
+	case models.NOT_EQUAL:
+		return comparison != 0
+	case models.LESS:
+		return comparison < 0
+	case models.LESS_EQUAL:
+		return comparison <= 0
+	case models.GREATER:
+		return comparison > 0
+	case models.GREATER_EQUAL:
+		return comparison >= 0
+	}
+
+	return false
+}
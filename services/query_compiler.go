@@ -0,0 +1,1090 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+var columns = map[string]models.Column{
+	"content":     models.CONTENT_COLUMN,
+	"line":        models.LINE_COLUMN,
+	"line_number": models.LINE_COLUMN,
+	"path":        models.PATH_COLUMN,
+	"filename":    models.FILENAME_COLUMN,
+	"ext":         models.EXT_COLUMN,
+	"dir":         models.DIR_COLUMN,
+	"size":        models.SIZE_COLUMN,
+	"mtime":       models.MTIME_COLUMN,
+}
+
+type QueryCompiler struct{}
+
+func NewQueryCompiler() *QueryCompiler {
+	return &QueryCompiler{}
+}
+
+func (queryCompiler *QueryCompiler) Compile(statement models.Statement) (models.Command, error) {
+	var command models.Command
+	var err error
+
+	command, err = queryCompiler.compileStatement(statement)
+	if err != nil {
+		return command, err
+	}
+
+	switch statement := statement.(type) {
+	case *models.SelectStatement:
+		err = queryCompiler.compileLimit(&command, statement.Limit, statement.Offset)
+	case *models.UpdateStatement:
+		err = queryCompiler.compileLimit(&command, statement.Limit, nil)
+	case *models.DeleteStatement:
+		err = queryCompiler.compileLimit(&command, statement.Limit, nil)
+	case *models.InsertStatement:
+		err = queryCompiler.compileLimit(&command, statement.Limit, nil)
+	}
+
+	return command, err
+}
+
+func (queryCompiler *QueryCompiler) compileStatement(statement models.Statement) (models.Command, error) {
+	var command models.Command
+	var err error
+
+	switch statement := statement.(type) {
+	case *models.SelectStatement:
+		command.Action = models.SELECT
+		command.Sources = statement.Sources
+		command.Excludes = statement.Excludes
+		command.Where, err = queryCompiler.compileWhere(statement.Where)
+		if err != nil {
+			return command, err
+		}
+		if command.Where == nil {
+			command.Where = &models.TruePredicate{}
+		}
+
+		if queryCompiler.isCountAll(statement.Columns) && len(statement.GroupBy) == 0 && statement.Having == nil {
+			command.Action = models.COUNT
+			return command, nil
+		}
+
+		command.Columns, err = queryCompiler.compileColumns(statement.Columns)
+		if err != nil {
+			return command, err
+		}
+		command.Distinct = statement.Distinct
+
+		if len(statement.GroupBy) > 0 || statement.Having != nil || queryCompiler.hasAggregate(statement) {
+			err = queryCompiler.compileGrouping(&command, statement)
+			if err != nil {
+				return command, err
+			}
+		}
+
+		command.OrderBy, err = queryCompiler.compileSortKeys(statement.OrderBy, statement.Columns, command.Columns)
+		if err != nil {
+			return command, err
+		}
+
+		if command.IsGrouped {
+			for index, key := range command.OrderBy {
+				if !queryCompiler.isGroupValue(key.Operand, command.GroupBy) {
+					return command, queryCompiler.ungroupedError(statement.OrderBy[index].Expression)
+				}
+			}
+		}
+
+		command.Aggregates = queryCompiler.collectAggregates(command)
+
+	case *models.UpdateStatement:
+		command.Action = models.UPDATE
+		command.Sources = statement.Sources
+		command.Excludes = statement.Excludes
+
+		var replacements []models.Replacement
+		for _, assignment := range statement.Assignments {
+			replacement, err := queryCompiler.compileAssignment(assignment)
+			if err != nil {
+				return command, err
+			}
+			replacements = append(replacements, replacement)
+		}
+
+		if len(replacements) > 1 {
+			command.IsBatch = true
+			command.Replacements = replacements
+			return command, nil
+		}
+
+		replacement := replacements[0]
+		command.Where = replacement.Where
+		command.Pattern = replacement.Pattern
+		command.Replace = replacement.Replace
+		command.MatchExact = replacement.MatchExact
+		command.Expand = replacement.Expand
+
+	case *models.InsertStatement:
+		command.Action = models.INSERT
+		command.Sources = statement.Sources
+		command.Excludes = statement.Excludes
+		command.Position = statement.Position
+		command.Where, err = queryCompiler.compileWhere(statement.Where)
+		if err != nil {
+			return command, err
+		}
+
+		for _, value := range statement.Values {
+			if call := queryCompiler.findAggregate(value); call != nil {
+				return command, newParseError(call.Token, fmt.Sprintf("aggregate function %s is not allowed in VALUES", strings.ToUpper(call.Name)))
+			}
+
+			operand, err := queryCompiler.compileOperand(value)
+			if err != nil {
+				return command, err
+			}
+			command.Values = append(command.Values, operand)
+		}
+
+	case *models.DeleteStatement:
+		command.Action = models.DELETE
+		command.Sources = statement.Sources
+		command.Excludes = statement.Excludes
+
+		if len(statement.Wheres) > 1 {
+			command.IsBatch = true
+			for _, where := range statement.Wheres {
+				var deletion models.Deletion
+				deletion.Where, err = queryCompiler.compileWhere(where)
+				if err != nil {
+					return command, err
+				}
+				command.Deletions = append(command.Deletions, deletion)
+			}
+			return command, nil
+		}
+
+		if len(statement.Wheres) == 1 {
+			command.Where, err = queryCompiler.compileWhere(statement.Wheres[0])
+		}
+	}
+
+	return command, err
+}
+
+func (queryCompiler *QueryCompiler) compileLimit(command *models.Command, limit *models.NumberLiteral, offset *models.NumberLiteral) error {
+	if limit == nil {
+		return nil
+	}
+
+	var err error
+	command.HasLimit = true
+	command.Limit, err = queryCompiler.compileCount("LIMIT", limit)
+	if err != nil || offset == nil {
+		return err
+	}
+
+	command.Offset, err = queryCompiler.compileCount("OFFSET", offset)
+	return err
+}
+
+func (queryCompiler *QueryCompiler) compileCount(clause string, literal *models.NumberLiteral) (int, error) {
+	count, err := strconv.Atoi(literal.Token.Value)
+	if err != nil {
+		return 0, newParseError(literal.Token, clause+" expects a whole number")
+	}
+
+	// Only a bound parameter can be negative, the lexer reads no sign.
+	if count < 0 {
+		return 0, newParseError(literal.Token, clause+" cannot be negative")
+	}
+
+	return count, nil
+}
+
+// compileWhere compiles a WHERE clause, which is evaluated line by line and so
+// cannot use aggregate functions.
+func (queryCompiler *QueryCompiler) compileWhere(condition models.Expression) (models.Predicate, error) {
+	if call := queryCompiler.findAggregate(condition); call != nil {
+		return nil, newParseError(call.Token, fmt.Sprintf("aggregate function %s is not allowed in WHERE", strings.ToUpper(call.Name)))
+	}
+
+	return queryCompiler.compilePredicate(condition)
+}
+
+// A missing condition compiles to a nil predicate, which a SELECT replaces
+// with one that matches every line. UPDATE and DELETE cannot leave WHERE out.
+func (queryCompiler *QueryCompiler) compilePredicate(condition models.Expression) (models.Predicate, error) {
+	switch condition := condition.(type) {
+	case *models.LogicalExpression:
+		left, err := queryCompiler.compilePredicate(condition.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := queryCompiler.compilePredicate(condition.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		if condition.Operator == "AND" {
+			return &models.AndPredicate{Left: left, Right: right}, nil
+		}
+
+		return &models.OrPredicate{Left: left, Right: right}, nil
+
+	case *models.NotExpression:
+		operand, err := queryCompiler.compilePredicate(condition.Operand)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.NotPredicate{Operand: operand}, nil
+
+	case *models.ComparisonExpression:
+		left, err := queryCompiler.compileOperand(condition.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		literal, isString := condition.Right.(*models.StringLiteral)
+		if condition.Operator == models.EQUAL && isString && queryCompiler.isContent(left) {
+			pattern := regexp.MustCompile("^" + regexp.QuoteMeta(literal.Value) + "$")
+			return &models.PatternPredicate{Operand: left, Pattern: pattern, MatchExact: true}, nil
+		}
+
+		right, err := queryCompiler.compileOperand(condition.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.ComparisonPredicate{Operator: condition.Operator, Left: left, Right: right}, nil
+
+	case *models.BetweenExpression:
+		operand, err := queryCompiler.compileOperand(condition.Operand)
+		if err != nil {
+			return nil, err
+		}
+
+		low, err := queryCompiler.compileOperand(condition.Low)
+		if err != nil {
+			return nil, err
+		}
+
+		high, err := queryCompiler.compileOperand(condition.High)
+		if err != nil {
+			return nil, err
+		}
+
+		var predicate models.Predicate = &models.AndPredicate{
+			Left:  &models.ComparisonPredicate{Operator: models.GREATER_EQUAL, Left: operand, Right: low},
+			Right: &models.ComparisonPredicate{Operator: models.LESS_EQUAL, Left: operand, Right: high},
+		}
+		if condition.Negated {
+			predicate = &models.NotPredicate{Operand: predicate}
+		}
+
+		return predicate, nil
+
+	case *models.LikeExpression:
+		operand, err := queryCompiler.compileOperand(condition.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		escape := ""
+		if condition.Escape != nil {
+			escape = condition.Escape.Value
+			if utf8.RuneCountInString(escape) != 1 {
+				return nil, newParseError(condition.Escape.Token, "ESCAPE must be a single character")
+			}
+		}
+
+		pattern, err := queryCompiler.likeToRegex(condition.Pattern.Value, escape, condition.CaseInsensitive)
+		if err != nil {
+			return nil, newParseError(condition.Pattern.Token, err.Error())
+		}
+
+		var predicate models.Predicate = &models.PatternPredicate{Operand: operand, Pattern: pattern}
+		if condition.Negated {
+			predicate = &models.NotPredicate{Operand: predicate}
+		}
+
+		return predicate, nil
+
+	case *models.RegexpExpression:
+		operand, err := queryCompiler.compileOperand(condition.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := regexp.Compile(condition.Pattern.Value)
+		if err != nil {
+			return nil, newParseError(condition.Pattern.Token, "invalid regular expression: "+err.Error())
+		}
+
+		var predicate models.Predicate = &models.PatternPredicate{Operand: operand, Pattern: pattern, IsRegexp: true}
+		if condition.Negated {
+			predicate = &models.NotPredicate{Operand: predicate}
+		}
+
+		return predicate, nil
+	}
+
+	return nil, nil
+}
+
+// compileColumns returns nil for SELECT *, which keeps its own output format.
+func (queryCompiler *QueryCompiler) compileColumns(selectColumns []models.SelectColumn) ([]models.Operand, error) {
+	if len(selectColumns) == 1 {
+		if _, ok := selectColumns[0].Expression.(*models.StarExpression); ok {
+			return nil, nil
+		}
+	}
+
+	var columns []models.Operand
+	for _, selectColumn := range selectColumns {
+		if star, ok := selectColumn.Expression.(*models.StarExpression); ok {
+			return nil, newParseError(star.Token, "* cannot be combined with other columns")
+		}
+
+		column, err := queryCompiler.compileOperand(selectColumn.Expression)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// compileGrouping compiles GROUP BY and HAVING, and checks that every SELECT
+// column has a single value per group.
+func (queryCompiler *QueryCompiler) compileGrouping(command *models.Command, statement *models.SelectStatement) error {
+	if command.Columns == nil {
+		return newParseError(queryCompiler.expressionToken(statement.Columns[0].Expression), "SELECT * cannot be combined with GROUP BY or aggregate functions")
+	}
+
+	command.IsGrouped = true
+
+	for _, expression := range statement.GroupBy {
+		if call := queryCompiler.findAggregate(expression); call != nil {
+			return newParseError(call.Token, fmt.Sprintf("aggregate function %s is not allowed in GROUP BY", strings.ToUpper(call.Name)))
+		}
+
+		key, err := queryCompiler.compileOutputOperand("GROUP BY", expression, statement.Columns, command.Columns)
+		if err != nil {
+			return err
+		}
+		command.GroupBy = append(command.GroupBy, key)
+	}
+
+	for index, selectColumn := range statement.Columns {
+		if !queryCompiler.isGroupValue(command.Columns[index], command.GroupBy) {
+			return queryCompiler.ungroupedError(selectColumn.Expression)
+		}
+	}
+
+	var err error
+	command.Having, err = queryCompiler.compilePredicate(statement.Having)
+	if err != nil {
+		return err
+	}
+
+	if !queryCompiler.isGroupPredicate(command.Having, command.GroupBy) {
+		return queryCompiler.ungroupedError(queryCompiler.findUngrouped(statement.Having, command.GroupBy))
+	}
+
+	return nil
+}
+
+func (queryCompiler *QueryCompiler) ungroupedError(expression models.Expression) error {
+	message := fmt.Sprintf("%s must appear in GROUP BY or be used in an aggregate function", queryCompiler.expressionName(expression))
+	return newParseError(queryCompiler.expressionToken(expression), message)
+}
+
+// findUngrouped returns the value of a HAVING condition that can differ
+// between the rows of a group, to point the error at it.
+func (queryCompiler *QueryCompiler) findUngrouped(expression models.Expression, groupBy []models.Operand) models.Expression {
+	var children []models.Expression
+
+	switch expression := expression.(type) {
+	case *models.LogicalExpression:
+		children = []models.Expression{expression.Left, expression.Right}
+	case *models.NotExpression:
+		children = []models.Expression{expression.Operand}
+	case *models.ComparisonExpression:
+		children = []models.Expression{expression.Left, expression.Right}
+	case *models.BetweenExpression:
+		children = []models.Expression{expression.Operand, expression.Low, expression.High}
+	case *models.LikeExpression:
+		children = []models.Expression{expression.Left}
+	case *models.RegexpExpression:
+		children = []models.Expression{expression.Left}
+	default:
+		operand, err := queryCompiler.compileOperand(expression)
+		if err != nil || !queryCompiler.isGroupValue(operand, groupBy) {
+			return expression
+		}
+		return nil
+	}
+
+	for _, child := range children {
+		if ungrouped := queryCompiler.findUngrouped(child, groupBy); ungrouped != nil {
+			return ungrouped
+		}
+	}
+
+	return nil
+}
+
+// isGroupValue reports whether operand is the same for every row of a group:
+// an aggregate, a literal, a GROUP BY key or a function of those.
+func (queryCompiler *QueryCompiler) isGroupValue(operand models.Operand, groupBy []models.Operand) bool {
+	for _, key := range groupBy {
+		if reflect.DeepEqual(operand, key) {
+			return true
+		}
+	}
+
+	switch operand := operand.(type) {
+	case *models.AggregateOperand, *models.LiteralOperand:
+		return true
+	case *models.FunctionOperand:
+		for _, argument := range operand.Arguments {
+			if !queryCompiler.isGroupValue(argument, groupBy) {
+				return false
+			}
+		}
+		return true
+	case *models.CaseOperand:
+		for _, when := range operand.Whens {
+			if !queryCompiler.isGroupPredicate(when.Condition, groupBy) || !queryCompiler.isGroupValue(when.Result, groupBy) {
+				return false
+			}
+		}
+		return operand.Else == nil || queryCompiler.isGroupValue(operand.Else, groupBy)
+	}
+
+	return false
+}
+
+func (queryCompiler *QueryCompiler) isGroupPredicate(predicate models.Predicate, groupBy []models.Operand) bool {
+	switch predicate := predicate.(type) {
+	case *models.AndPredicate:
+		return queryCompiler.isGroupPredicate(predicate.Left, groupBy) && queryCompiler.isGroupPredicate(predicate.Right, groupBy)
+	case *models.OrPredicate:
+		return queryCompiler.isGroupPredicate(predicate.Left, groupBy) && queryCompiler.isGroupPredicate(predicate.Right, groupBy)
+	case *models.NotPredicate:
+		return queryCompiler.isGroupPredicate(predicate.Operand, groupBy)
+	case *models.PatternPredicate:
+		return queryCompiler.isGroupValue(predicate.Operand, groupBy)
+	case *models.ComparisonPredicate:
+		return queryCompiler.isGroupValue(predicate.Left, groupBy) && queryCompiler.isGroupValue(predicate.Right, groupBy)
+	}
+
+	return true
+}
+
+func (queryCompiler *QueryCompiler) hasAggregate(statement *models.SelectStatement) bool {
+	for _, selectColumn := range statement.Columns {
+		if queryCompiler.findAggregate(selectColumn.Expression) != nil {
+			return true
+		}
+	}
+
+	for _, term := range statement.OrderBy {
+		if queryCompiler.findAggregate(term.Expression) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findAggregate returns the first aggregate function call in expression.
+func (queryCompiler *QueryCompiler) findAggregate(expression models.Expression) *models.FunctionCall {
+	var children []models.Expression
+
+	switch expression := expression.(type) {
+	case *models.FunctionCall:
+		if aggregateFunctions[strings.ToUpper(expression.Name)] {
+			return expression
+		}
+		children = expression.Arguments
+	case *models.LogicalExpression:
+		children = []models.Expression{expression.Left, expression.Right}
+	case *models.NotExpression:
+		children = []models.Expression{expression.Operand}
+	case *models.ComparisonExpression:
+		children = []models.Expression{expression.Left, expression.Right}
+	case *models.BetweenExpression:
+		children = []models.Expression{expression.Operand, expression.Low, expression.High}
+	case *models.LikeExpression:
+		children = []models.Expression{expression.Left}
+	case *models.RegexpExpression:
+		children = []models.Expression{expression.Left}
+	case *models.ConcatExpression:
+		children = []models.Expression{expression.Left, expression.Right}
+	case *models.CaseExpression:
+		for _, when := range expression.Whens {
+			children = append(children, when.Condition, when.Result)
+		}
+		children = append(children, expression.Else)
+	}
+
+	for _, child := range children {
+		if call := queryCompiler.findAggregate(child); call != nil {
+			return call
+		}
+	}
+
+	return nil
+}
+
+// collectAggregates lists the aggregates a grouped SELECT computes and gives
+// each one its position in Row.Aggregates.
+func (queryCompiler *QueryCompiler) collectAggregates(command models.Command) []*models.AggregateOperand {
+	var aggregates []*models.AggregateOperand
+
+	for _, column := range command.Columns {
+		aggregates = queryCompiler.collectOperandAggregates(column, aggregates)
+	}
+
+	aggregates = queryCompiler.collectPredicateAggregates(command.Having, aggregates)
+
+	for _, key := range command.OrderBy {
+		aggregates = queryCompiler.collectOperandAggregates(key.Operand, aggregates)
+	}
+
+	return aggregates
+}
+
+func (queryCompiler *QueryCompiler) collectOperandAggregates(operand models.Operand, aggregates []*models.AggregateOperand) []*models.AggregateOperand {
+	switch operand := operand.(type) {
+	case *models.AggregateOperand:
+		for _, aggregate := range aggregates {
+			if aggregate == operand {
+				return aggregates
+			}
+		}
+		operand.Index = len(aggregates)
+		return append(aggregates, operand)
+
+	case *models.FunctionOperand:
+		for _, argument := range operand.Arguments {
+			aggregates = queryCompiler.collectOperandAggregates(argument, aggregates)
+		}
+
+	case *models.CaseOperand:
+		for _, when := range operand.Whens {
+			aggregates = queryCompiler.collectPredicateAggregates(when.Condition, aggregates)
+			aggregates = queryCompiler.collectOperandAggregates(when.Result, aggregates)
+		}
+		aggregates = queryCompiler.collectOperandAggregates(operand.Else, aggregates)
+	}
+
+	return aggregates
+}
+
+func (queryCompiler *QueryCompiler) collectPredicateAggregates(predicate models.Predicate, aggregates []*models.AggregateOperand) []*models.AggregateOperand {
+	switch predicate := predicate.(type) {
+	case *models.AndPredicate:
+		aggregates = queryCompiler.collectPredicateAggregates(predicate.Left, aggregates)
+		return queryCompiler.collectPredicateAggregates(predicate.Right, aggregates)
+	case *models.OrPredicate:
+		aggregates = queryCompiler.collectPredicateAggregates(predicate.Left, aggregates)
+		return queryCompiler.collectPredicateAggregates(predicate.Right, aggregates)
+	case *models.NotPredicate:
+		return queryCompiler.collectPredicateAggregates(predicate.Operand, aggregates)
+	case *models.PatternPredicate:
+		return queryCompiler.collectOperandAggregates(predicate.Operand, aggregates)
+	case *models.ComparisonPredicate:
+		aggregates = queryCompiler.collectOperandAggregates(predicate.Left, aggregates)
+		return queryCompiler.collectOperandAggregates(predicate.Right, aggregates)
+	}
+
+	return aggregates
+}
+
+func (queryCompiler *QueryCompiler) compileSortKeys(terms []models.OrderTerm, selectColumns []models.SelectColumn, columns []models.Operand) ([]models.SortKey, error) {
+	var keys []models.SortKey
+	for _, term := range terms {
+		operand, err := queryCompiler.compileOutputOperand("ORDER BY", term.Expression, selectColumns, columns)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, models.SortKey{Operand: operand, Descending: term.Descending})
+	}
+
+	return keys, nil
+}
+
+// compileOutputOperand resolves an ORDER BY or GROUP BY term, where a number
+// is the position of a SELECT column and an AS alias names one.
+func (queryCompiler *QueryCompiler) compileOutputOperand(clause string, expression models.Expression, selectColumns []models.SelectColumn, columns []models.Operand) (models.Operand, error) {
+	switch expression := expression.(type) {
+	case *models.NumberLiteral:
+		position, err := strconv.Atoi(expression.Token.Value)
+		if err != nil || position < 1 || position > len(columns) {
+			return nil, newParseError(expression.Token, fmt.Sprintf("%s position %s is not in the SELECT list", clause, expression.Token.Value))
+		}
+		return columns[position-1], nil
+
+	case *models.ColumnReference:
+		for index, selectColumn := range selectColumns {
+			if strings.EqualFold(selectColumn.Alias, expression.Name) && index < len(columns) {
+				return columns[index], nil
+			}
+		}
+	}
+
+	return queryCompiler.compileOperand(expression)
+}
+
+func (queryCompiler *QueryCompiler) isCountAll(selectColumns []models.SelectColumn) bool {
+	if len(selectColumns) != 1 {
+		return false
+	}
+
+	call, ok := selectColumns[0].Expression.(*models.FunctionCall)
+	if !ok || !strings.EqualFold(call.Name, "COUNT") || call.Distinct || len(call.Arguments) != 1 {
+		return false
+	}
+
+	_, ok = call.Arguments[0].(*models.StarExpression)
+	return ok
+}
+
+func (queryCompiler *QueryCompiler) expressionToken(expression models.Expression) models.Token {
+	switch expression := expression.(type) {
+	case *models.ColumnReference:
+		return expression.Token
+	case *models.StringLiteral:
+		return expression.Token
+	case *models.NumberLiteral:
+		return expression.Token
+	case *models.StarExpression:
+		return expression.Token
+	case *models.FunctionCall:
+		return expression.Token
+	case *models.ConcatExpression:
+		return queryCompiler.expressionToken(expression.Left)
+	case *models.CaseExpression:
+		return expression.Token
+	}
+
+	return models.Token{}
+}
+
+// expressionName spells out an expression the way it was written, for error
+// messages, with function names upper cased.
+func (queryCompiler *QueryCompiler) expressionName(expression models.Expression) string {
+	switch expression := expression.(type) {
+	case *models.ColumnReference:
+		return expression.Name
+	case *models.StringLiteral:
+		return "'" + strings.ReplaceAll(expression.Value, "'", "''") + "'"
+	case *models.NumberLiteral:
+		return expression.Token.Value
+	case *models.StarExpression:
+		return "*"
+	case *models.FunctionCall:
+		arguments := make([]string, len(expression.Arguments))
+		for index, argument := range expression.Arguments {
+			arguments[index] = queryCompiler.expressionName(argument)
+		}
+		distinct := ""
+		if expression.Distinct {
+			distinct = "DISTINCT "
+		}
+		return strings.ToUpper(expression.Name) + "(" + distinct + strings.Join(arguments, ", ") + ")"
+	case *models.ConcatExpression:
+		return queryCompiler.expressionName(expression.Left) + " || " + queryCompiler.expressionName(expression.Right)
+	case *models.CaseExpression:
+		return "CASE"
+	}
+
+	return ""
+}
+
+func (queryCompiler *QueryCompiler) compileOperand(expression models.Expression) (models.Operand, error) {
+	switch expression := expression.(type) {
+	case *models.ColumnReference:
+		column, err := queryCompiler.resolveColumn(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.ColumnOperand{Column: column}, nil
+
+	case *models.StringLiteral:
+		return &models.LiteralOperand{Value: models.Value{Text: expression.Value}}, nil
+
+	case *models.NumberLiteral:
+		value := models.Value{Text: expression.Token.Value, Number: expression.Value, IsNumber: true}
+		return &models.LiteralOperand{Value: value}, nil
+
+	case *models.FunctionCall:
+		return queryCompiler.compileFunctionCall(expression)
+
+	case *models.ConcatExpression:
+		left, err := queryCompiler.compileOperand(expression.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := queryCompiler.compileOperand(expression.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.FunctionOperand{Name: "CONCAT", Arguments: []models.Operand{left, right}}, nil
+
+	case *models.CaseExpression:
+		return queryCompiler.compileCase(expression)
+
+	case *models.StarExpression:
+		return nil, newParseError(expression.Token, "* is only allowed as SELECT * or COUNT(*)")
+	}
+
+	return nil, fmt.Errorf("unsupported expression %T", expression)
+}
+
+func (queryCompiler *QueryCompiler) compileCase(expression *models.CaseExpression) (models.Operand, error) {
+	operand := &models.CaseOperand{}
+	for _, when := range expression.Whens {
+		condition, err := queryCompiler.compilePredicate(when.Condition)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := queryCompiler.compileOperand(when.Result)
+		if err != nil {
+			return nil, err
+		}
+
+		operand.Whens = append(operand.Whens, models.CaseWhen{Condition: condition, Result: result})
+	}
+
+	if expression.Else != nil {
+		var err error
+		operand.Else, err = queryCompiler.compileOperand(expression.Else)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return operand, nil
+}
+
+func (queryCompiler *QueryCompiler) compileFunctionCall(call *models.FunctionCall) (models.Operand, error) {
+	name := strings.ToUpper(call.Name)
+	if aggregateFunctions[name] {
+		return queryCompiler.compileAggregateCall(call)
+	}
+
+	if call.Distinct {
+		return nil, newParseError(call.Token, "DISTINCT is only allowed in aggregate functions")
+	}
+
+	function, ok := scalarFunctions[name]
+	if !ok {
+		names := make([]string, 0, len(scalarFunctions)+len(aggregateFunctions))
+		for functionName := range scalarFunctions {
+			names = append(names, functionName)
+		}
+		for functionName := range aggregateFunctions {
+			names = append(names, functionName)
+		}
+		sort.Strings(names)
+
+		parseError := newParseError(call.Token, fmt.Sprintf("function %s is not supported here", call.Name))
+		parseError.Suggestion = closestMatch(name, names)
+		return nil, parseError
+	}
+
+	if len(call.Arguments) < function.minArguments || (function.maxArguments >= 0 && len(call.Arguments) > function.maxArguments) {
+		return nil, newParseError(call.Token, fmt.Sprintf("%s expects %s", name, queryCompiler.describeArity(function)))
+	}
+
+	operand := &models.FunctionOperand{Name: name}
+	for _, argument := range call.Arguments {
+		compiled, err := queryCompiler.compileOperand(argument)
+		if err != nil {
+			return nil, err
+		}
+		operand.Arguments = append(operand.Arguments, compiled)
+	}
+
+	return operand, nil
+}
+
+func (queryCompiler *QueryCompiler) compileAggregateCall(call *models.FunctionCall) (models.Operand, error) {
+	name := strings.ToUpper(call.Name)
+	if len(call.Arguments) != 1 {
+		return nil, newParseError(call.Token, fmt.Sprintf("%s expects 1 argument", name))
+	}
+
+	argument := call.Arguments[0]
+	if star, ok := argument.(*models.StarExpression); ok {
+		if name != "COUNT" || call.Distinct {
+			return nil, newParseError(star.Token, "* is only allowed in COUNT(*)")
+		}
+		return &models.AggregateOperand{Name: name}, nil
+	}
+
+	if nested := queryCompiler.findAggregate(argument); nested != nil {
+		return nil, newParseError(nested.Token, "aggregate functions cannot be nested")
+	}
+
+	operand, err := queryCompiler.compileOperand(argument)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AggregateOperand{Name: name, Argument: operand, Distinct: call.Distinct}, nil
+}
+
+func (queryCompiler *QueryCompiler) describeArity(function scalarFunction) string {
+	switch {
+	case function.maxArguments < 0:
+		return fmt.Sprintf("at least %d argument(s)", function.minArguments)
+	case function.minArguments == function.maxArguments && function.minArguments == 1:
+		return "1 argument"
+	case function.minArguments == function.maxArguments:
+		return fmt.Sprintf("%d arguments", function.minArguments)
+	}
+
+	return fmt.Sprintf("%d to %d arguments", function.minArguments, function.maxArguments)
+}
+
+// compileAssignment lowers a SET clause. A value that does not read any
+// column replaces the text matched by a single content condition, expanding
+// $1 and ${name} when that condition is a REGEXP. Any other expression, such
+// as REPLACE(content, 'from', 'to') or '- [x]' || SUBSTR(content, 6), is
+// evaluated for each line and replaces the whole line.
+func (queryCompiler *QueryCompiler) compileAssignment(assignment models.Assignment) (models.Replacement, error) {
+	var replacement models.Replacement
+
+	column, err := queryCompiler.resolveColumn(assignment.Column)
+	if err != nil {
+		return replacement, err
+	}
+
+	if column != models.CONTENT_COLUMN {
+		return replacement, newParseError(assignment.Column.Token, fmt.Sprintf("column %s cannot be updated", assignment.Column.Name))
+	}
+
+	where, err := queryCompiler.compileWhere(assignment.Where)
+	if err != nil {
+		return replacement, err
+	}
+	replacement.Where = where
+
+	if call := queryCompiler.findAggregate(assignment.Value); call != nil {
+		return replacement, newParseError(call.Token, fmt.Sprintf("aggregate function %s is not allowed in SET", strings.ToUpper(call.Name)))
+	}
+
+	replacement.Replace, err = queryCompiler.compileOperand(assignment.Value)
+	if err != nil {
+		return replacement, err
+	}
+
+	if caseOperand, ok := replacement.Replace.(*models.CaseOperand); ok {
+		queryCompiler.scopeCase(&replacement, caseOperand)
+	}
+
+	if !queryCompiler.isConstant(replacement.Replace) {
+		return replacement, nil
+	}
+
+	replacement.Pattern, replacement.MatchExact = queryCompiler.singlePattern(where)
+
+	if patternPredicate := queryCompiler.contentPattern(where); patternPredicate != nil {
+		replacement.Expand = patternPredicate.IsRegexp
+	}
+
+	return replacement, nil
+}
+
+// scopeCase keeps the lines that no WHEN matches when SET content = CASE has
+// no ELSE. Without a WHERE clause such a CASE updates only the lines one of
+// its WHEN conditions matches, and a CASE with an ELSE updates every line.
+func (queryCompiler *QueryCompiler) scopeCase(replacement *models.Replacement, caseOperand *models.CaseOperand) {
+	if replacement.Where == nil {
+		if caseOperand.Else != nil {
+			replacement.Where = &models.TruePredicate{}
+		} else {
+			for _, when := range caseOperand.Whens {
+				if replacement.Where == nil {
+					replacement.Where = when.Condition
+				} else {
+					replacement.Where = &models.OrPredicate{Left: replacement.Where, Right: when.Condition}
+				}
+			}
+		}
+	}
+
+	if caseOperand.Else == nil {
+		caseOperand.Else = &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	}
+}
+
+func (queryCompiler *QueryCompiler) isConstant(operand models.Operand) bool {
+	switch operand := operand.(type) {
+	case *models.LiteralOperand:
+		return true
+	case *models.FunctionOperand:
+		for _, argument := range operand.Arguments {
+			if !queryCompiler.isConstant(argument) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// singlePattern returns the pattern of the content match that a literal
+// UPDATE replaces. The WHERE clause must hold exactly one such match, and
+// whatever is ANDed to it may only filter lines, like line > 1 or NOT
+// content LIKE '%done'.
+func (queryCompiler *QueryCompiler) singlePattern(predicate models.Predicate) (*regexp.Regexp, bool) {
+	patternPredicate := queryCompiler.contentPattern(predicate)
+	if patternPredicate == nil {
+		return nil, false
+	}
+
+	return patternPredicate.Pattern, patternPredicate.MatchExact
+}
+
+func (queryCompiler *QueryCompiler) contentPattern(predicate models.Predicate) *models.PatternPredicate {
+	var found *models.PatternPredicate
+	for _, conjunct := range queryCompiler.conjuncts(predicate) {
+		patternPredicate, ok := conjunct.(*models.PatternPredicate)
+		if ok && queryCompiler.isContent(patternPredicate.Operand) {
+			if found != nil {
+				return nil
+			}
+			found = patternPredicate
+			continue
+		}
+
+		if queryCompiler.hasContentPattern(conjunct) {
+			return nil
+		}
+	}
+
+	return found
+}
+
+func (queryCompiler *QueryCompiler) conjuncts(predicate models.Predicate) []models.Predicate {
+	if and, ok := predicate.(*models.AndPredicate); ok {
+		return append(queryCompiler.conjuncts(and.Left), queryCompiler.conjuncts(and.Right)...)
+	}
+
+	return []models.Predicate{predicate}
+}
+
+// hasContentPattern reports whether predicate may match lines through a
+// content pattern, which would leave the text to replace ambiguous. Negated
+// patterns only filter lines.
+func (queryCompiler *QueryCompiler) hasContentPattern(predicate models.Predicate) bool {
+	switch predicate := predicate.(type) {
+	case *models.PatternPredicate:
+		return queryCompiler.isContent(predicate.Operand)
+	case *models.AndPredicate:
+		return queryCompiler.hasContentPattern(predicate.Left) || queryCompiler.hasContentPattern(predicate.Right)
+	case *models.OrPredicate:
+		return queryCompiler.hasContentPattern(predicate.Left) || queryCompiler.hasContentPattern(predicate.Right)
+	}
+
+	return false
+}
+
+func (queryCompiler *QueryCompiler) isContent(operand models.Operand) bool {
+	column, ok := operand.(*models.ColumnOperand)
+	return ok && column.Column == models.CONTENT_COLUMN
+}
+
+func (queryCompiler *QueryCompiler) resolveColumn(reference *models.ColumnReference) (models.Column, error) {
+	if column, ok := columns[strings.ToLower(reference.Name)]; ok {
+		return column, nil
+	}
+
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parseError := newParseError(reference.Token, fmt.Sprintf("unknown column %q", reference.Name))
+	parseError.Suggestion = closestMatch(reference.Name, names)
+	return "", parseError
+}
+
+// likeToRegex translates a LIKE pattern where % matches any run of characters
+// and _ a single one. Leading and trailing % are left out of the regexp so
+// that UPDATE only replaces the text in between, and a pattern without any
+// wildcard matches lines that contain it.
+func (queryCompiler *QueryCompiler) likeToRegex(pattern string, escape string, caseInsensitive bool) (*regexp.Regexp, error) {
+	var parts []string
+	hasWildcard := false
+	escaped := false
+
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			parts = append(parts, regexp.QuoteMeta(string(char)))
+			escaped = false
+		case escape != "" && string(char) == escape:
+			escaped = true
+		case char == '%':
+			parts = append(parts, ".*")
+			hasWildcard = true
+		case char == '_':
+			parts = append(parts, ".")
+			hasWildcard = true
+		default:
+			parts = append(parts, regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("LIKE pattern must not end with the escape character")
+	}
+
+	hasStart := len(parts) > 0 && parts[0] == ".*"
+	for len(parts) > 0 && parts[0] == ".*" {
+		parts = parts[1:]
+	}
+
+	hasEnd := len(parts) > 0 && parts[len(parts)-1] == ".*"
+	for len(parts) > 0 && parts[len(parts)-1] == ".*" {
+		parts = parts[:len(parts)-1]
+	}
+
+	expression := strings.Join(parts, "")
+
+	if !hasStart && (hasEnd || hasWildcard) {
+		expression = "^" + expression
+	}
+
+	if !hasEnd && (hasStart || hasWildcard) {
+		expression = expression + "$"
+	}
+
+	if caseInsensitive {
+		expression = "(?i)" + expression
+	}
+
+	return regexp.MustCompile(expression), nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+var aggregateFunctions = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"MIN":   true,
+	"MAX":   true,
+	"AVG":   true,
+}
+
+type aggregateState struct {
+	seen     map[string]bool
+	count    int
+	sum      float64
+	value    models.Value
+	hasValue bool
+}
+
+type rowGroup struct {
+	row    models.Row
+	states []aggregateState
+}
+
+// RowGrouper folds matching rows into one row per distinct GROUP BY key,
+// keeping groups in the order they were first seen. Without GROUP BY keys
+// every row belongs to a single group.
+type RowGrouper struct {
+	keys               []models.Operand
+	aggregates         []*models.AggregateOperand
+	predicateEvaluator *PredicateEvaluator
+	groups             map[string]*rowGroup
+	order              []*rowGroup
+}
+
+func NewRowGrouper(keys []models.Operand, aggregates []*models.AggregateOperand) *RowGrouper {
+	return &RowGrouper{
+		keys:               keys,
+		aggregates:         aggregates,
+		predicateEvaluator: NewPredicateEvaluator(),
+		groups:             make(map[string]*rowGroup),
+	}
+}
+
+func (rowGrouper *RowGrouper) Add(row models.Row) {
+	group := rowGrouper.group(row)
+
+	for index, aggregate := range rowGrouper.aggregates {
+		var value models.Value
+		if aggregate.Argument != nil {
+			value = rowGrouper.predicateEvaluator.Evaluate(aggregate.Argument, row)
+		}
+
+		state := &group.states[index]
+		if aggregate.Distinct {
+			if state.seen == nil {
+				state.seen = make(map[string]bool)
+			}
+			if state.seen[value.Text] {
+				continue
+			}
+			state.seen[value.Text] = true
+		}
+
+		rowGrouper.accumulate(aggregate.Name, state, value)
+	}
+}
+
+// Each calls visit with the row of every group, its Aggregates filled in,
+// until visit returns false. Without GROUP BY keys a single row is produced
+// even when nothing matched, so that COUNT(*) reports 0.
+func (rowGrouper *RowGrouper) Each(visit func(row models.Row) bool) {
+	if len(rowGrouper.keys) == 0 && len(rowGrouper.order) == 0 {
+		rowGrouper.group(models.Row{})
+	}
+
+	for _, group := range rowGrouper.order {
+		row := group.row
+		row.Aggregates = make([]models.Value, len(rowGrouper.aggregates))
+		for index, aggregate := range rowGrouper.aggregates {
+			row.Aggregates[index] = rowGrouper.result(aggregate.Name, group.states[index])
+		}
+
+		if !visit(row) {
+			return
+		}
+	}
+}
+
+func (rowGrouper *RowGrouper) group(row models.Row) *rowGroup {
+	values := make([]string, len(rowGrouper.keys))
+	for index, key := range rowGrouper.keys {
+		values[index] = rowGrouper.predicateEvaluator.Evaluate(key, row).Text
+	}
+	key := strings.Join(values, "\x00")
+
+	group, ok := rowGrouper.groups[key]
+	if !ok {
+		group = &rowGroup{row: row, states: make([]aggregateState, len(rowGrouper.aggregates))}
+		rowGrouper.groups[key] = group
+		rowGrouper.order = append(rowGrouper.order, group)
+	}
+
+	return group
+}
+
+// SUM and AVG skip values that are not numbers.
+func (rowGrouper *RowGrouper) accumulate(name string, state *aggregateState, value models.Value) {
+	switch name {
+	case "COUNT":
+		state.count++
+	case "SUM", "AVG":
+		if number, ok := toNumber(value); ok {
+			state.sum += number
+			state.count++
+		}
+	case "MIN":
+		if !state.hasValue || rowGrouper.predicateEvaluator.compare(value, state.value) < 0 {
+			state.value = value
+			state.hasValue = true
+		}
+	case "MAX":
+		if !state.hasValue || rowGrouper.predicateEvaluator.compare(value, state.value) > 0 {
+			state.value = value
+			state.hasValue = true
+		}
+	}
+}
+
+func (rowGrouper *RowGrouper) result(name string, state aggregateState) models.Value {
+	switch name {
+	case "COUNT":
+		return numberValue(int64(state.count))
+	case "SUM":
+		if state.count > 0 {
+			return floatValue(state.sum)
+		}
+	case "AVG":
+		if state.count > 0 {
+			return floatValue(state.sum / float64(state.count))
+		}
+	case "MIN", "MAX":
+		return state.value
+	}
+
+	return models.Value{}
+}
+
+func floatValue(number float64) models.Value {
+	return models.Value{Text: strconv.FormatFloat(number, 'f', -1, 64), Number: number, IsNumber: true}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+const MAX_SORT_ROWS_IN_MEMORY = 100000
+
+type sortRow struct {
+	Keys     []models.Value
+	Output   string
+	Sequence int
+}
+
+// sortRun is one sorted sequence of rows, either still in memory or spilled
+// to a temporary file.
+type sortRun struct {
+	rows    []sortRow
+	decoder *gob.Decoder
+	current sortRow
+}
+
+// RowSorter orders SELECT output by the ORDER BY keys. Once more than
+// maxRowsInMemory rows have been added, each sorted chunk is written to a
+// temporary file and the chunks are merged back when the rows are read.
+type RowSorter struct {
+	keys               []models.SortKey
+	maxRowsInMemory    int
+	predicateEvaluator *PredicateEvaluator
+	rows               []sortRow
+	spills             []string
+	sequence           int
+}
+
+func NewRowSorter(keys []models.SortKey, maxRowsInMemory int) *RowSorter {
+	return &RowSorter{
+		keys:               keys,
+		maxRowsInMemory:    maxRowsInMemory,
+		predicateEvaluator: NewPredicateEvaluator(),
+	}
+}
+
+func (rowSorter *RowSorter) Add(row models.Row, output string) error {
+	keys := make([]models.Value, len(rowSorter.keys))
+	for index, key := range rowSorter.keys {
+		keys[index] = rowSorter.predicateEvaluator.Evaluate(key.Operand, row)
+	}
+
+	rowSorter.rows = append(rowSorter.rows, sortRow{Keys: keys, Output: output, Sequence: rowSorter.sequence})
+	rowSorter.sequence++
+
+	if len(rowSorter.rows) < rowSorter.maxRowsInMemory {
+		return nil
+	}
+
+	if err := rowSorter.spill(); err != nil {
+		rowSorter.removeSpills()
+		return err
+	}
+
+	return nil
+}
+
+// Each calls visit with the output of every row in order, until visit
+// returns false. Temporary files are removed before it returns.
+func (rowSorter *RowSorter) Each(visit func(output string) bool) error {
+	defer rowSorter.removeSpills()
+
+	rowSorter.sortRows(rowSorter.rows)
+	runs := &sortRuns{rowSorter: rowSorter}
+
+	for _, spill := range rowSorter.spills {
+		file, err := os.Open(spill)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		run := &sortRun{decoder: gob.NewDecoder(bufio.NewReader(file))}
+		if err := runs.push(run); err != nil {
+			return err
+		}
+	}
+
+	if err := runs.push(&sortRun{rows: rowSorter.rows}); err != nil {
+		return err
+	}
+
+	for runs.Len() > 0 {
+		run := runs.runs[0]
+		if !visit(run.current.Output) {
+			return nil
+		}
+
+		hasNext, err := run.next()
+		if err != nil {
+			return err
+		}
+
+		if hasNext {
+			heap.Fix(runs, 0)
+		} else {
+			heap.Pop(runs)
+		}
+	}
+
+	return nil
+}
+
+func (rowSorter *RowSorter) spill() error {
+	rowSorter.sortRows(rowSorter.rows)
+
+	file, err := os.CreateTemp("", "sqd-sort-*")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rowSorter.spills = append(rowSorter.spills, file.Name())
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for _, row := range rowSorter.rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	rowSorter.rows = rowSorter.rows[:0]
+	return nil
+}
+
+func (rowSorter *RowSorter) removeSpills() {
+	for _, spill := range rowSorter.spills {
+		os.Remove(spill)
+	}
+	rowSorter.spills = nil
+}
+
+func (rowSorter *RowSorter) sortRows(rows []sortRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		return rowSorter.less(rows[i], rows[j])
+	})
+}
+
+// Rows with equal keys keep the order in which they were added, so that
+// ties stay in file and line order.
+func (rowSorter *RowSorter) less(left sortRow, right sortRow) bool {
+	for index, key := range rowSorter.keys {
+		comparison := rowSorter.predicateEvaluator.compare(left.Keys[index], right.Keys[index])
+		if key.Descending {
+			comparison = -comparison
+		}
+
+		if comparison != 0 {
+			return comparison < 0
+		}
+	}
+
+	return left.Sequence < right.Sequence
+}
+
+func (sortRun *sortRun) next() (bool, error) {
+	if sortRun.decoder == nil {
+		if len(sortRun.rows) == 0 {
+			return false, nil
+		}
+
+		sortRun.current = sortRun.rows[0]
+		sortRun.rows = sortRun.rows[1:]
+		return true, nil
+	}
+
+	var row sortRow
+	if err := sortRun.decoder.Decode(&row); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	sortRun.current = row
+	return true, nil
+}
+
+// sortRuns is a heap of runs ordered by their current row.
+type sortRuns struct {
+	rowSorter *RowSorter
+	runs      []*sortRun
+}
+
+func (sortRuns *sortRuns) push(run *sortRun) error {
+	hasNext, err := run.next()
+	if err != nil || !hasNext {
+		return err
+	}
+
+	heap.Push(sortRuns, run)
+	return nil
+}
+
+func (sortRuns *sortRuns) Len() int {
+	return len(sortRuns.runs)
+}
+
+func (sortRuns *sortRuns) Less(i, j int) bool {
+	return sortRuns.rowSorter.less(sortRuns.runs[i].current, sortRuns.runs[j].current)
+}
+
+func (sortRuns *sortRuns) Swap(i, j int) {
+	sortRuns.runs[i], sortRuns.runs[j] = sortRuns.runs[j], sortRuns.runs[i]
+}
+
+func (sortRuns *sortRuns) Push(run any) {
+	sortRuns.runs = append(sortRuns.runs, run.(*sortRun))
+}
+
+func (sortRuns *sortRuns) Pop() any {
+	last := sortRuns.runs[len(sortRuns.runs)-1]
+	sortRuns.runs = sortRuns.runs[:len(sortRuns.runs)-1]
+	return last
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/albertoboccolini/sqd/models"
+)
+
+// TRIM_CHARACTERS is what TRIM, LTRIM and RTRIM remove when no characters
+// are given.
+const TRIM_CHARACTERS = " \t\r"
+
+// scalarFunction accepts between minArguments and maxArguments arguments, a
+// negative maxArguments meaning any number.
+type scalarFunction struct {
+	minArguments int
+	maxArguments int
+	apply        func(arguments []models.Value) models.Value
+}
+
+var scalarFunctions = map[string]scalarFunction{
+	"UPPER": {minArguments: 1, maxArguments: 1, apply: func(arguments []models.Value) models.Value {
+		return models.Value{Text: strings.ToUpper(arguments[0].Text)}
+	}},
+	"LOWER": {minArguments: 1, maxArguments: 1, apply: func(arguments []models.Value) models.Value {
+		return models.Value{Text: strings.ToLower(arguments[0].Text)}
+	}},
+	"LENGTH": {minArguments: 1, maxArguments: 1, apply: func(arguments []models.Value) models.Value {
+		length := utf8.RuneCountInString(arguments[0].Text)
+		return numberValue(int64(length))
+	}},
+	"TRIM": {minArguments: 1, maxArguments: 2, apply: func(arguments []models.Value) models.Value {
+		return models.Value{Text: strings.Trim(arguments[0].Text, trimCharacters(arguments))}
+	}},
+	"LTRIM": {minArguments: 1, maxArguments: 2, apply: func(arguments []models.Value) models.Value {
+		return models.Value{Text: strings.TrimLeft(arguments[0].Text, trimCharacters(arguments))}
+	}},
+	"RTRIM": {minArguments: 1, maxArguments: 2, apply: func(arguments []models.Value) models.Value {
+		return models.Value{Text: strings.TrimRight(arguments[0].Text, trimCharacters(arguments))}
+	}},
+	"SUBSTR": {minArguments: 2, maxArguments: 3, apply: substr},
+	"REPLACE": {minArguments: 3, maxArguments: 3, apply: func(arguments []models.Value) models.Value {
+		if arguments[1].Text == "" {
+			return models.Value{Text: arguments[0].Text}
+		}
+		return models.Value{Text: strings.ReplaceAll(arguments[0].Text, arguments[1].Text, arguments[2].Text)}
+	}},
+	"LPAD": {minArguments: 2, maxArguments: 3, apply: func(arguments []models.Value) models.Value {
+		return pad(arguments, true)
+	}},
+	"RPAD": {minArguments: 2, maxArguments: 3, apply: func(arguments []models.Value) models.Value {
+		return pad(arguments, false)
+	}},
+	"INSTR": {minArguments: 2, maxArguments: 2, apply: func(arguments []models.Value) models.Value {
+		index := strings.Index(arguments[0].Text, arguments[1].Text)
+		if index < 0 {
+			return numberValue(0)
+		}
+		return numberValue(int64(utf8.RuneCountInString(arguments[0].Text[:index]) + 1))
+	}},
+	"CONCAT": {minArguments: 1, maxArguments: -1, apply: func(arguments []models.Value) models.Value {
+		var text strings.Builder
+		for _, argument := range arguments {
+			text.WriteString(argument.Text)
+		}
+		return models.Value{Text: text.String()}
+	}},
+}
+
+func trimCharacters(arguments []models.Value) string {
+	if len(arguments) > 1 {
+		return arguments[1].Text
+	}
+
+	return TRIM_CHARACTERS
+}
+
+// substr counts characters from 1, and from the end of the string when start
+// is negative.
+func substr(arguments []models.Value) models.Value {
+	runes := []rune(arguments[0].Text)
+	start := integerArgument(arguments[1])
+
+	switch {
+	case start > 0:
+		start--
+	case start < 0:
+		start = max(len(runes)+start, 0)
+	}
+	start = min(start, len(runes))
+
+	end := len(runes)
+	if len(arguments) > 2 {
+		end = min(start+max(integerArgument(arguments[2]), 0), len(runes))
+	}
+
+	return models.Value{Text: string(runes[start:end])}
+}
+
+// pad fills the string up to the given number of characters with spaces, or
+// with the optional third argument, and cuts it when it is longer.
+func pad(arguments []models.Value, left bool) models.Value {
+	runes := []rune(arguments[0].Text)
+	length := max(integerArgument(arguments[1]), 0)
+	if len(runes) >= length {
+		return models.Value{Text: string(runes[:length])}
+	}
+
+	fill := []rune(" ")
+	if len(arguments) > 2 {
+		fill = []rune(arguments[2].Text)
+	}
+	if len(fill) == 0 {
+		return models.Value{Text: string(runes)}
+	}
+
+	padding := make([]rune, 0, length-len(runes))
+	for len(padding) < length-len(runes) {
+		padding = append(padding, fill[len(padding)%len(fill)])
+	}
+
+	if left {
+		return models.Value{Text: string(padding) + string(runes)}
+	}
+
+	return models.Value{Text: string(runes) + string(padding)}
+}
+
+func integerArgument(value models.Value) int {
+	number, _ := toNumber(value)
+	return int(number)
+}
+
+func toNumber(value models.Value) (float64, bool) {
+	if value.IsNumber {
+		return value.Number, true
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value.Text), 64)
+	return number, err == nil
+}
+
+func numberValue(number int64) models.Value {
+	return models.Value{Text: strconv.FormatInt(number, 10), Number: float64(number), IsNumber: true}
+}
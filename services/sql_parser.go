@@ -1,204 +1,944 @@
 package services
 
 import (
-	"regexp"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/albertoboccolini/sqd/models"
 )
 
-type SQLParser struct{}
+// SQLParser reads the tokens of a query into a statement with one token of
+// lookahead, and hands the statement to its QueryCompiler.
+type SQLParser struct {
+	lexer         *Lexer
+	peeked        models.Token
+	hasPeeked     bool
+	queryCompiler *QueryCompiler
+	named         map[string]string
+	positional    []string
+	nextPosition  int
+}
 
 func NewSQLParser() *SQLParser {
-	return &SQLParser{}
+	return &SQLParser{queryCompiler: NewQueryCompiler()}
+}
+
+// Parse returns a *models.ParseError when the query is malformed or refers
+// to something sqd does not know about.
+func (sqlParser *SQLParser) Parse(sql string) (models.Command, error) {
+	statement, err := sqlParser.ParseStatement(sql)
+	if err != nil {
+		return models.Command{}, err
+	}
+
+	return sqlParser.queryCompiler.Compile(statement)
+}
+
+// ParseScript parses and compiles every statement of sql. Statements are
+// separated by semicolons, and empty statements are ignored.
+func (sqlParser *SQLParser) ParseScript(sql string) ([]models.Command, error) {
+	statements, err := sqlParser.ParseStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]models.Command, 0, len(statements))
+	for _, statement := range statements {
+		command, err := sqlParser.queryCompiler.Compile(statement)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+// ParseStatement parses sql as a single statement, optionally followed by a
+// semicolon.
+func (sqlParser *SQLParser) ParseStatement(sql string) (models.Statement, error) {
+	sqlParser.reset(sql)
+
+	statement, err := sqlParser.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlParser.accept(models.SEMICOLON)
+	if err := sqlParser.expectEnd(); err != nil {
+		return nil, err
+	}
+
+	return statement, sqlParser.checkPositional()
+}
+
+func (sqlParser *SQLParser) ParseStatements(sql string) ([]models.Statement, error) {
+	sqlParser.reset(sql)
+
+	var statements []models.Statement
+	for {
+		for sqlParser.accept(models.SEMICOLON) {
+		}
+
+		if len(statements) > 0 && sqlParser.peek().Kind == models.EOF {
+			return statements, sqlParser.checkPositional()
+		}
+
+		statement, err := sqlParser.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+
+		if !sqlParser.accept(models.SEMICOLON) {
+			if err := sqlParser.expectEnd(describeKind(models.SEMICOLON)); err != nil {
+				return nil, err
+			}
+			return statements, sqlParser.checkPositional()
+		}
+	}
 }
 
-func (sqlParser *SQLParser) Parse(sql string) models.Command {
-	sql = strings.TrimSpace(sql)
-	upperSql := strings.ToUpper(sql)
+// SetParameters gives the values that replace the ? and :name placeholders of
+// the next queries, the n-th ? taking the n-th positional value.
+func (sqlParser *SQLParser) SetParameters(named map[string]string, positional []string) {
+	sqlParser.named = named
+	sqlParser.positional = positional
+}
 
-	var command models.Command
+func (sqlParser *SQLParser) reset(sql string) {
+	sqlParser.lexer = NewLexer(sql)
+	sqlParser.hasPeeked = false
+	sqlParser.nextPosition = 0
+}
 
-	if strings.HasPrefix(upperSql, "SELECT COUNT") {
-		command.Action = models.COUNT
-		command.File = sqlParser.extractBetween(sql, "FROM", "WHERE")
+// checkPositional reports positional values that no ? placeholder used.
+func (sqlParser *SQLParser) checkPositional() error {
+	if sqlParser.nextPosition < len(sqlParser.positional) {
+		return fmt.Errorf("%d positional values given, but the query has %d ? placeholders", len(sqlParser.positional), sqlParser.nextPosition)
 	}
 
-	if strings.HasPrefix(upperSql, "SELECT") && !strings.HasPrefix(upperSql, "SELECT COUNT") {
-		command.Action = models.SELECT
-		command.File = sqlParser.extractBetween(sql, "FROM", "WHERE")
+	return nil
+}
+
+// parseParameter returns the value bound to the placeholder at the current
+// token.
+func (sqlParser *SQLParser) parseParameter() (string, models.Token, error) {
+	token := sqlParser.next()
+
+	if token.Value == "?" {
+		if sqlParser.nextPosition >= len(sqlParser.positional) {
+			return "", token, newParseError(token, fmt.Sprintf("no value for placeholder %d", sqlParser.nextPosition+1))
+		}
+
+		value := sqlParser.positional[sqlParser.nextPosition]
+		sqlParser.nextPosition++
+		return value, token, nil
 	}
 
-	if strings.HasPrefix(upperSql, "UPDATE") {
-		command.Action = models.UPDATE
-		command.File = sqlParser.extractBetween(sql, "UPDATE", "SET")
+	value, ok := sqlParser.named[token.Value[1:]]
+	if !ok {
+		return "", token, newParseError(token, fmt.Sprintf("no value for parameter %s", token.Value))
 	}
 
-	if strings.HasPrefix(upperSql, "DELETE") {
-		command.Action = models.DELETE
-		command.File = sqlParser.extractBetween(sql, "DELETE FROM", "WHERE")
+	return value, token, nil
+}
+
+func (sqlParser *SQLParser) parseStatement() (models.Statement, error) {
+	token := sqlParser.peek()
+	switch {
+	case sqlParser.isKeyword(token, "SELECT"):
+		return sqlParser.parseSelect()
+	case sqlParser.isKeyword(token, "UPDATE"):
+		return sqlParser.parseUpdate()
+	case sqlParser.isKeyword(token, "DELETE"):
+		return sqlParser.parseDelete()
+	case sqlParser.isKeyword(token, "INSERT"):
+		return sqlParser.parseInsert()
 	}
 
-	command.File = strings.TrimSpace(command.File)
+	return nil, sqlParser.unexpected(token, "SELECT", "UPDATE", "DELETE", "INSERT")
+}
+
+func (sqlParser *SQLParser) parseSelect() (*models.SelectStatement, error) {
+	sqlParser.next()
+	statement := &models.SelectStatement{Distinct: sqlParser.acceptKeyword("DISTINCT")}
+
+	for {
+		expression, err := sqlParser.parseSelectColumn()
+		if err != nil {
+			return nil, err
+		}
+
+		column := models.SelectColumn{Expression: expression}
+		if sqlParser.acceptKeyword("AS") {
+			alias, err := sqlParser.expect(models.IDENT)
+			if err != nil {
+				return nil, err
+			}
+			column.Alias = alias.Value
+		}
+		statement.Columns = append(statement.Columns, column)
+
+		if !sqlParser.accept(models.COMMA) {
+			break
+		}
+	}
 
-	if command.Action == models.UPDATE && strings.Count(upperSql, "SET CONTENT=") > 1 {
-		command.IsBatch = true
-		command.Replacements = sqlParser.parseBatchReplacements(sql)
-		return command
+	if err := sqlParser.expectKeyword("FROM"); err != nil {
+		return nil, err
 	}
 
-	if command.Action == models.DELETE && strings.Count(upperSql, "WHERE CONTENT =") > 1 {
-		command.IsBatch = true
-		command.Deletions = sqlParser.parseBatchDeletions(sql)
-		return command
+	var err error
+	statement.Sources, statement.Excludes, err = sqlParser.parseSourcesAndExcludes()
+	if err != nil {
+		return nil, err
 	}
 
-	if strings.Contains(upperSql, "WHERE CONTENT") {
-		whereContentRegex := regexp.MustCompile(`(?i)WHERE\s+content\s*=\s*`)
-		loc := whereContentRegex.FindStringIndex(sql)
-		if loc != nil {
-			command.MatchExact = true
-			exactMatch := strings.TrimSpace(sql[loc[1]:])
-			exactMatch = strings.Trim(exactMatch, " '\"")
-			command.Pattern = regexp.MustCompile("^" + regexp.QuoteMeta(exactMatch) + "$")
+	alternatives := []string{"WHERE", "GROUP", "HAVING", "ORDER", "LIMIT"}
+	if sqlParser.acceptKeyword("WHERE") {
+		statement.Where, err = sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
 		}
+		alternatives = []string{"AND", "OR", "GROUP", "HAVING", "ORDER", "LIMIT"}
 	}
 
-	if strings.Contains(upperSql, "WHERE CONTENT LIKE") {
-		command.MatchExact = false
-		likePattern := sqlParser.extractAfter(sql, "LIKE")
-		likePattern = strings.Trim(likePattern, " '\"")
-		command.Pattern = sqlParser.likeToRegex(likePattern)
+	if sqlParser.acceptKeyword("GROUP") {
+		statement.GroupBy, err = sqlParser.parseGroupBy()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = []string{describeKind(models.COMMA), "HAVING", "ORDER", "LIMIT"}
 	}
 
-	if command.Action == models.UPDATE {
-		setContentRegex := regexp.MustCompile(`(?i)SET\s+content\s*=\s*`)
-		whereIdx := strings.Index(upperSql, "WHERE")
-		if whereIdx == -1 {
-			whereIdx = len(sql)
+	if sqlParser.acceptKeyword("HAVING") {
+		statement.Having, err = sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
 		}
+		alternatives = []string{"AND", "OR", "ORDER", "LIMIT"}
+	}
 
-		loc := setContentRegex.FindStringIndex(sql)
-		if loc != nil {
-			command.Replace = strings.TrimSpace(sql[loc[1]:whereIdx])
-			command.Replace = strings.Trim(command.Replace, " '\"")
+	if sqlParser.acceptKeyword("ORDER") {
+		statement.OrderBy, err = sqlParser.parseOrderBy()
+		if err != nil {
+			return nil, err
 		}
+		alternatives = []string{describeKind(models.COMMA), "LIMIT"}
+	}
+
+	if !sqlParser.acceptKeyword("LIMIT") {
+		return statement, sqlParser.expectEnd(alternatives...)
+	}
+
+	statement.Limit, err = sqlParser.parseNumber()
+	if err != nil {
+		return nil, err
 	}
 
-	return command
+	if !sqlParser.acceptKeyword("OFFSET") {
+		return statement, sqlParser.expectEnd("OFFSET")
+	}
+
+	statement.Offset, err = sqlParser.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, sqlParser.expectEnd()
 }
 
-func (sqlParser *SQLParser) parseBatchDeletions(sql string) []models.Deletion {
-	var deletions []models.Deletion
+func (sqlParser *SQLParser) parseGroupBy() ([]models.Expression, error) {
+	if err := sqlParser.expectKeyword("BY"); err != nil {
+		return nil, err
+	}
 
-	parts := strings.SplitSeq(sql, ",")
+	var expressions []models.Expression
+	for {
+		expression, err := sqlParser.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+
+		if !sqlParser.accept(models.COMMA) {
+			return expressions, nil
+		}
+	}
+}
 
-	for part := range parts {
-		part = strings.TrimSpace(part)
-		upper := strings.ToUpper(part)
+func (sqlParser *SQLParser) parseOrderBy() ([]models.OrderTerm, error) {
+	if err := sqlParser.expectKeyword("BY"); err != nil {
+		return nil, err
+	}
 
-		if !strings.Contains(upper, "WHERE CONTENT =") {
-			continue
+	var terms []models.OrderTerm
+	for {
+		expression, err := sqlParser.parseExpression()
+		if err != nil {
+			return nil, err
 		}
 
-		var del models.Deletion
-		del.MatchExact = true
+		term := models.OrderTerm{Expression: expression}
+		if sqlParser.acceptKeyword("DESC") {
+			term.Descending = true
+		} else {
+			sqlParser.acceptKeyword("ASC")
+		}
+		terms = append(terms, term)
 
-		exactMatch := sqlParser.extractAfter(part, "WHERE content =")
-		exactMatch = strings.Trim(exactMatch, " '\"")
-		del.Pattern = regexp.MustCompile("^" + regexp.QuoteMeta(exactMatch) + "$")
+		if !sqlParser.accept(models.COMMA) {
+			return terms, nil
+		}
+	}
+}
 
-		deletions = append(deletions, del)
+func (sqlParser *SQLParser) parseSelectColumn() (models.Expression, error) {
+	if token := sqlParser.peek(); token.Kind == models.STAR {
+		sqlParser.next()
+		return &models.StarExpression{Token: token}, nil
 	}
 
-	return deletions
+	return sqlParser.parseExpression()
 }
 
-func (sqlParser *SQLParser) parseBatchReplacements(sql string) []models.Replacement {
-	var replacements []models.Replacement
+func (sqlParser *SQLParser) parseUpdate() (*models.UpdateStatement, error) {
+	sqlParser.next()
+	statement := &models.UpdateStatement{}
 
-	parts := strings.SplitSeq(sql, ",")
+	var err error
+	statement.Sources, statement.Excludes, err = sqlParser.parseSourcesAndExcludes()
+	if err != nil {
+		return nil, err
+	}
 
-	for part := range parts {
-		part = strings.TrimSpace(part)
-		upperPart := strings.ToUpper(part)
+	for {
+		assignment, err := sqlParser.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		statement.Assignments = append(statement.Assignments, assignment)
 
-		if !strings.Contains(upperPart, "SET CONTENT=") {
+		if sqlParser.accept(models.COMMA) {
 			continue
 		}
 
-		var repl models.Replacement
+		alternatives := []string{describeKind(models.COMMA), "LIMIT"}
+		if assignment.Where == nil {
+			alternatives = append([]string{"WHERE"}, alternatives...)
+		}
+
+		if sqlParser.acceptKeyword("LIMIT") {
+			statement.Limit, err = sqlParser.parseNumber()
+			if err != nil {
+				return nil, err
+			}
+			alternatives = nil
+		}
+
+		return statement, sqlParser.expectEnd(alternatives...)
+	}
+}
+
+func (sqlParser *SQLParser) parseAssignment() (models.Assignment, error) {
+	var assignment models.Assignment
+
+	if err := sqlParser.expectKeyword("SET"); err != nil {
+		return assignment, err
+	}
+
+	column, err := sqlParser.expect(models.IDENT)
+	if err != nil {
+		return assignment, err
+	}
+	assignment.Column = &models.ColumnReference{Name: column.Value, Token: column}
+
+	if _, err := sqlParser.expect(models.EQUAL); err != nil {
+		return assignment, err
+	}
+
+	assignment.Value, err = sqlParser.parseExpression()
+	if err != nil {
+		return assignment, err
+	}
+
+	// Only SET content = CASE may leave out WHERE, its WHEN conditions pick
+	// the lines to update.
+	if !sqlParser.acceptKeyword("WHERE") {
+		if _, ok := assignment.Value.(*models.CaseExpression); ok {
+			return assignment, nil
+		}
+
+		return assignment, sqlParser.unexpected(sqlParser.peek(), "WHERE")
+	}
+
+	assignment.Where, err = sqlParser.parseCondition()
+	if err != nil {
+		return assignment, err
+	}
+
+	return assignment, nil
+}
+
+func (sqlParser *SQLParser) parseDelete() (*models.DeleteStatement, error) {
+	sqlParser.next()
+	statement := &models.DeleteStatement{}
+
+	if err := sqlParser.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	statement.Sources, statement.Excludes, err = sqlParser.parseSourcesAndExcludes()
+	if err != nil {
+		return nil, err
+	}
+
+	if !sqlParser.acceptKeyword("WHERE") {
+		return nil, sqlParser.unexpected(sqlParser.peek(), "WHERE")
+	}
+
+	for {
+		where, err := sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		statement.Wheres = append(statement.Wheres, where)
+
+		if !sqlParser.accept(models.COMMA) {
+			if !sqlParser.acceptKeyword("LIMIT") {
+				return statement, sqlParser.expectEnd(describeKind(models.COMMA), "AND", "OR", "LIMIT")
+			}
+
+			statement.Limit, err = sqlParser.parseNumber()
+			if err != nil {
+				return nil, err
+			}
+
+			return statement, sqlParser.expectEnd()
+		}
 
-		replaceValue := sqlParser.extractBetween(part, "SET content=", "WHERE")
-		replaceValue = strings.Trim(replaceValue, " '\"")
-		repl.Replace = replaceValue
+		if err := sqlParser.expectKeyword("WHERE"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (sqlParser *SQLParser) parseInsert() (*models.InsertStatement, error) {
+	sqlParser.next()
+	statement := &models.InsertStatement{}
+
+	if err := sqlParser.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	statement.Sources, statement.Excludes, err = sqlParser.parseSourcesAndExcludes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlParser.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+
+	if _, err := sqlParser.expect(models.LEFT_PAREN); err != nil {
+		return nil, err
+	}
+
+	for {
+		value, err := sqlParser.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		statement.Values = append(statement.Values, value)
+
+		if !sqlParser.accept(models.COMMA) {
+			break
+		}
+	}
+
+	if _, err := sqlParser.expect(models.RIGHT_PAREN); err != nil {
+		return nil, err
+	}
+
+	token := sqlParser.next()
+	switch {
+	case sqlParser.isKeyword(token, "AT"):
+		end := sqlParser.next()
+		switch {
+		case sqlParser.isKeyword(end, "START"):
+			statement.Position = models.INSERT_AT_START
+		case sqlParser.isKeyword(end, "END"):
+			statement.Position = models.INSERT_AT_END
+		default:
+			return nil, sqlParser.unexpected(end, "START", "END")
+		}
+
+	case sqlParser.isKeyword(token, "AFTER"), sqlParser.isKeyword(token, "BEFORE"):
+		statement.Position = models.INSERT_AFTER
+		if sqlParser.isKeyword(token, "BEFORE") {
+			statement.Position = models.INSERT_BEFORE
+		}
 
-		if strings.Contains(upperPart, "WHERE CONTENT =") {
-			repl.MatchExact = true
-			exactMatch := sqlParser.extractAfter(part, "WHERE content =")
-			exactMatch = strings.Trim(exactMatch, " '\"")
-			repl.Pattern = regexp.MustCompile("^" + regexp.QuoteMeta(exactMatch) + "$")
+		if err := sqlParser.expectKeyword("WHERE"); err != nil {
+			return nil, err
 		}
 
-		if strings.Contains(upperPart, "WHERE CONTENT LIKE") {
-			repl.MatchExact = false
-			likePattern := sqlParser.extractAfter(part, "LIKE")
-			likePattern = strings.Trim(likePattern, " '\"")
-			repl.Pattern = sqlParser.likeToRegex(likePattern)
+		statement.Where, err = sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, sqlParser.unexpected(token, "AT", "AFTER", "BEFORE")
+	}
+
+	if sqlParser.acceptKeyword("LIMIT") {
+		statement.Limit, err = sqlParser.parseNumber()
+		if err != nil {
+			return nil, err
 		}
+		return statement, sqlParser.expectEnd()
+	}
 
-		replacements = append(replacements, repl)
+	if statement.Where != nil {
+		return statement, sqlParser.expectEnd("AND", "OR", "LIMIT")
 	}
 
-	return replacements
+	return statement, sqlParser.expectEnd("LIMIT")
 }
 
-func (sqlParser *SQLParser) extractBetween(query, start, end string) string {
-	upperStart := strings.ToUpper(start)
-	upperEnd := strings.ToUpper(end)
-	upperQuery := strings.ToUpper(query)
+// parseSourcesAndExcludes parses the file patterns of FROM, INTO and UPDATE
+// followed by an optional EXCLUDE list of patterns to leave out.
+func (sqlParser *SQLParser) parseSourcesAndExcludes() ([]string, []string, error) {
+	sources, err := sqlParser.parseSources()
+	if err != nil || !sqlParser.acceptKeyword("EXCLUDE") {
+		return sources, nil, err
+	}
 
-	startIndex := strings.Index(upperQuery, upperStart)
-	if startIndex == -1 {
-		return ""
+	excludes, err := sqlParser.parseSources()
+	return sources, excludes, err
+}
+
+// parseSources parses a comma separated list of file patterns.
+func (sqlParser *SQLParser) parseSources() ([]string, error) {
+	var sources []string
+	for {
+		source, err := sqlParser.parseSource()
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+
+		if !sqlParser.accept(models.COMMA) {
+			return sources, nil
+		}
 	}
+}
 
-	startIndex += len(upperStart)
-	endIndex := strings.Index(upperQuery[startIndex:], upperEnd)
+func (sqlParser *SQLParser) parseSource() (string, error) {
+	token := sqlParser.lexer.NextPath()
+	if token.Kind != models.PATH && token.Kind != models.STRING {
+		return "", sqlParser.unexpected(token, describeKind(models.PATH))
+	}
 
-	if endIndex == -1 {
-		return strings.TrimSpace(query[startIndex:])
+	return token.Value, nil
+}
+
+// parseCondition parses a boolean expression where NOT binds tighter than
+// AND, and AND binds tighter than OR.
+func (sqlParser *SQLParser) parseCondition() (models.Expression, error) {
+	left, err := sqlParser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for sqlParser.acceptKeyword("OR") {
+		right, err := sqlParser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &models.LogicalExpression{Operator: "OR", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (sqlParser *SQLParser) parseAnd() (models.Expression, error) {
+	left, err := sqlParser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for sqlParser.acceptKeyword("AND") {
+		right, err := sqlParser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &models.LogicalExpression{Operator: "AND", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (sqlParser *SQLParser) parseNot() (models.Expression, error) {
+	if sqlParser.acceptKeyword("NOT") {
+		operand, err := sqlParser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.NotExpression{Operand: operand}, nil
+	}
+
+	if sqlParser.accept(models.LEFT_PAREN) {
+		condition, err := sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := sqlParser.expect(models.RIGHT_PAREN); err != nil {
+			return nil, err
+		}
+
+		return condition, nil
+	}
+
+	return sqlParser.parsePredicate()
+}
+
+var comparisonOperators = map[models.TokenKind]models.TokenKind{
+	models.EQUAL:         models.EQUAL,
+	models.NOT_EQUAL:     models.NOT_EQUAL,
+	models.LESS_GREATER:  models.NOT_EQUAL,
+	models.LESS:          models.LESS,
+	models.LESS_EQUAL:    models.LESS_EQUAL,
+	models.GREATER:       models.GREATER,
+	models.GREATER_EQUAL: models.GREATER_EQUAL,
+}
+
+func (sqlParser *SQLParser) parsePredicate() (models.Expression, error) {
+	left, err := sqlParser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	negated := sqlParser.acceptKeyword("NOT")
+
+	switch {
+	case sqlParser.acceptKeyword("LIKE"):
+		return sqlParser.parseLike(left, false, negated)
+	case sqlParser.acceptKeyword("ILIKE"):
+		return sqlParser.parseLike(left, true, negated)
+	case sqlParser.acceptKeyword("REGEXP"):
+		return sqlParser.parseRegexp(left, negated)
+	case sqlParser.acceptKeyword("BETWEEN"):
+		return sqlParser.parseBetween(left, negated)
+	case negated:
+		return nil, sqlParser.unexpected(sqlParser.next(), "LIKE", "ILIKE", "REGEXP", "BETWEEN")
+	case sqlParser.accept(models.TILDE):
+		return sqlParser.parseRegexp(left, false)
+	case sqlParser.accept(models.NOT_TILDE):
+		return sqlParser.parseRegexp(left, true)
+	}
+
+	token := sqlParser.next()
+	operator, ok := comparisonOperators[token.Kind]
+	if !ok {
+		return nil, sqlParser.unexpected(token, describeKind(models.EQUAL), describeKind(models.NOT_EQUAL), describeKind(models.LESS), describeKind(models.GREATER), "LIKE", "ILIKE", "REGEXP", "BETWEEN", "NOT", describeKind(models.TILDE), describeKind(models.NOT_TILDE))
+	}
+
+	right, err := sqlParser.parseExpression()
+	if err != nil {
+		return nil, err
 	}
 
-	return strings.TrimSpace(query[startIndex : startIndex+endIndex])
+	return &models.ComparisonExpression{Operator: operator, Left: left, Right: right}, nil
 }
 
-func (sqlParser *SQLParser) extractAfter(query, marker string) string {
-	markerUpper := strings.ToUpper(marker)
-	upperQuery := strings.ToUpper(query)
+func (sqlParser *SQLParser) parseBetween(operand models.Expression, negated bool) (models.Expression, error) {
+	low, err := sqlParser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlParser.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+
+	high, err := sqlParser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BetweenExpression{Operand: operand, Low: low, High: high, Negated: negated}, nil
+}
+
+func (sqlParser *SQLParser) parseLike(left models.Expression, caseInsensitive bool, negated bool) (models.Expression, error) {
+	pattern, err := sqlParser.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	like := &models.LikeExpression{Left: left, Pattern: pattern, CaseInsensitive: caseInsensitive, Negated: negated}
+
+	if sqlParser.acceptKeyword("ESCAPE") {
+		like.Escape, err = sqlParser.parseString()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return like, nil
+}
+
+func (sqlParser *SQLParser) parseRegexp(left models.Expression, negated bool) (models.Expression, error) {
+	pattern, err := sqlParser.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RegexpExpression{Left: left, Pattern: pattern, Negated: negated}, nil
+}
 
-	index := strings.Index(upperQuery, markerUpper)
-	if index == -1 {
-		return ""
+// parseExpression parses values joined with the || concatenation operator.
+func (sqlParser *SQLParser) parseExpression() (models.Expression, error) {
+	left, err := sqlParser.parseValue()
+	if err != nil {
+		return nil, err
 	}
 
-	return strings.TrimSpace(query[index+len(markerUpper):])
+	for sqlParser.accept(models.CONCAT) {
+		right, err := sqlParser.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		left = &models.ConcatExpression{Left: left, Right: right}
+	}
+
+	return left, nil
 }
 
-func (sqlParser *SQLParser) likeToRegex(pattern string) *regexp.Regexp {
-	hasStart := strings.HasPrefix(pattern, "%")
-	hasEnd := strings.HasSuffix(pattern, "%")
+// parseValue parses a string or number literal, a column or a function call
+// such as REPLACE(content, 'from', 'to').
+func (sqlParser *SQLParser) parseValue() (models.Expression, error) {
+	token := sqlParser.peek()
+	if token.Kind == models.STRING || token.Kind == models.PARAMETER {
+		return sqlParser.parseString()
+	}
+
+	if token.Kind == models.NUMBER {
+		return sqlParser.parseNumber()
+	}
+
+	if token.Kind == models.MINUS {
+		sqlParser.next()
+		number, err := sqlParser.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		number.Value = -number.Value
+		number.Token.Value = "-" + number.Token.Value
+		return number, nil
+	}
 
-	pattern = strings.Trim(pattern, "%")
-	pattern = regexp.QuoteMeta(pattern)
+	if sqlParser.isKeyword(token, "CASE") {
+		return sqlParser.parseCase()
+	}
+
+	if token.Kind != models.IDENT {
+		return nil, sqlParser.unexpected(sqlParser.next(), describeKind(models.STRING), describeKind(models.NUMBER), describeKind(models.IDENT))
+	}
 
-	if !hasStart && hasEnd {
-		pattern = "^" + pattern
+	sqlParser.next()
+	if !sqlParser.accept(models.LEFT_PAREN) {
+		return &models.ColumnReference{Name: token.Value, Token: token}, nil
 	}
 
-	if hasStart && !hasEnd {
-		pattern = pattern + "$"
+	call := &models.FunctionCall{Name: token.Value, Token: token}
+	if sqlParser.accept(models.RIGHT_PAREN) {
+		return call, nil
 	}
+	call.Distinct = sqlParser.acceptKeyword("DISTINCT")
+
+	for {
+		argument, err := sqlParser.parseSelectColumn()
+		if err != nil {
+			return nil, err
+		}
+		call.Arguments = append(call.Arguments, argument)
+
+		if !sqlParser.accept(models.COMMA) {
+			break
+		}
+	}
+
+	if _, err := sqlParser.expect(models.RIGHT_PAREN); err != nil {
+		return nil, err
+	}
+
+	return call, nil
+}
+
+func (sqlParser *SQLParser) parseCase() (*models.CaseExpression, error) {
+	expression := &models.CaseExpression{Token: sqlParser.next()}
+
+	if err := sqlParser.expectKeyword("WHEN"); err != nil {
+		return nil, err
+	}
+
+	for {
+		condition, err := sqlParser.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := sqlParser.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+
+		result, err := sqlParser.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expression.Whens = append(expression.Whens, models.WhenClause{Condition: condition, Result: result})
+
+		if !sqlParser.acceptKeyword("WHEN") {
+			break
+		}
+	}
+
+	if sqlParser.acceptKeyword("ELSE") {
+		var err error
+		expression.Else, err = sqlParser.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sqlParser.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+
+	return expression, nil
+}
+
+func (sqlParser *SQLParser) parseString() (*models.StringLiteral, error) {
+	if sqlParser.peek().Kind == models.PARAMETER {
+		value, token, err := sqlParser.parseParameter()
+		if err != nil {
+			return nil, err
+		}
+		return &models.StringLiteral{Value: value, Token: token}, nil
+	}
+
+	token, err := sqlParser.expect(models.STRING)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.StringLiteral{Value: token.Value, Token: token}, nil
+}
+
+func (sqlParser *SQLParser) parseNumber() (*models.NumberLiteral, error) {
+	if sqlParser.peek().Kind == models.PARAMETER {
+		value, token, err := sqlParser.parseParameter()
+		if err != nil {
+			return nil, err
+		}
+
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, newParseError(token, fmt.Sprintf("parameter %s is not a number: %s", token.Value, value))
+		}
+
+		token.Value = strconv.FormatFloat(number, 'f', -1, 64)
+		return &models.NumberLiteral{Value: number, Token: token}, nil
+	}
+
+	token, err := sqlParser.expect(models.NUMBER)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := strconv.ParseFloat(token.Value, 64)
+	if err != nil {
+		return nil, newParseError(token, "invalid number "+token.Value)
+	}
+
+	return &models.NumberLiteral{Value: value, Token: token}, nil
+}
+
+func (sqlParser *SQLParser) peek() models.Token {
+	if !sqlParser.hasPeeked {
+		sqlParser.peeked = sqlParser.lexer.Next()
+		sqlParser.hasPeeked = true
+	}
+
+	return sqlParser.peeked
+}
+
+func (sqlParser *SQLParser) next() models.Token {
+	token := sqlParser.peek()
+	sqlParser.hasPeeked = false
+	return token
+}
+
+func (sqlParser *SQLParser) accept(kind models.TokenKind) bool {
+	if sqlParser.peek().Kind != kind {
+		return false
+	}
+
+	sqlParser.next()
+	return true
+}
+
+func (sqlParser *SQLParser) acceptKeyword(keyword string) bool {
+	if !sqlParser.isKeyword(sqlParser.peek(), keyword) {
+		return false
+	}
+
+	sqlParser.next()
+	return true
+}
+
+func (sqlParser *SQLParser) expect(kind models.TokenKind) (models.Token, error) {
+	token := sqlParser.next()
+	if token.Kind != kind {
+		return token, sqlParser.unexpected(token, describeKind(kind))
+	}
+
+	return token, nil
+}
+
+func (sqlParser *SQLParser) expectKeyword(keyword string) error {
+	token := sqlParser.next()
+	if !sqlParser.isKeyword(token, keyword) {
+		return sqlParser.unexpected(token, keyword)
+	}
+
+	return nil
+}
+
+// expectEnd reports a leftover token together with the clauses that could
+// have appeared in its place, so that a typo like WHER still gets a hint.
+func (sqlParser *SQLParser) expectEnd(alternatives ...string) error {
+	token := sqlParser.peek()
+	if token.Kind == models.EOF || token.Kind == models.SEMICOLON {
+		return nil
+	}
+
+	return sqlParser.unexpected(token, append(alternatives, describeKind(models.EOF))...)
+}
+
+func (sqlParser *SQLParser) isKeyword(token models.Token, keyword string) bool {
+	return token.Kind == models.KEYWORD && token.Value == keyword
+}
 
-	return regexp.MustCompile(pattern)
+func (sqlParser *SQLParser) unexpected(token models.Token, expected ...string) error {
+	return newUnexpectedTokenError(token, expected...)
 }
@@ -2,8 +2,10 @@ package services
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -46,6 +48,51 @@ func (utils *Utils) IsPathInsideCwd(path string) bool {
 	return true
 }
 
+// PrintParseError shows the offending query line with a caret under the
+// token the parser stopped at.
+func (utils *Utils) PrintParseError(query string, parseError *models.ParseError) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", parseError)
+
+	lines := strings.Split(query, "\n")
+	if parseError.Line < 1 || parseError.Line > len(lines) {
+		return
+	}
+
+	line := strings.TrimRight(lines[parseError.Line-1], "\r")
+	var padding strings.Builder
+	for index, char := range []rune(line) {
+		if index >= parseError.Column-1 {
+			break
+		}
+
+		if char == '\t' {
+			padding.WriteRune('\t')
+			continue
+		}
+		padding.WriteRune(' ')
+	}
+
+	fmt.Fprintf(os.Stderr, "  %s\n", line)
+	fmt.Fprintf(os.Stderr, "  %s^\n", padding.String())
+
+	if parseError.Suggestion != "" {
+		fmt.Fprintf(os.Stderr, "Did you mean %s?\n", parseError.Suggestion)
+	}
+}
+
+// ReadScript reads the queries of -f from path, or from stdin when path is -.
+func (utils *Utils) ReadScript(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+
+	return string(data), err
+}
+
 func (utils *Utils) printUpdateMessage(total int) {
 	fmt.Printf("Updated: %d occurrences\n", total)
 }
@@ -56,10 +103,51 @@ func (utils *Utils) printProcessingErrorMessage(file string, err error) {
 
 func (utils *Utils) printStats(stats models.ExecutionStats) {
 	elapsed := time.Since(stats.StartTime).Seconds()
-	fmt.Printf("Processed: %d files in %.2fms\n", stats.Processed, elapsed*1000)
+	fmt.Fprintf(os.Stderr, "Processed: %d files in %.2fms\n", stats.Processed, elapsed*1000)
 	if stats.Skipped > 0 {
-		fmt.Printf("Skipped: %d files\n", stats.Skipped)
+		fmt.Fprintf(os.Stderr, "Skipped: %d files\n", stats.Skipped)
+	}
+}
+
+// replaceLine substitutes the text matched by pattern, or the whole line when
+// the WHERE clause was not a single content match. With expand, $1 and
+// ${name} in replace refer to the capture groups of pattern.
+func (utils *Utils) replaceLine(line string, pattern *regexp.Regexp, replace string, expand bool) string {
+	if pattern == nil {
+		return replace
 	}
+
+	if expand {
+		return pattern.ReplaceAllString(line, replace)
+	}
+
+	return pattern.ReplaceAllLiteralString(line, replace)
+}
+
+// copyFile copies source to target with the permissions of source.
+func (utils *Utils) copyFile(source string, target string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
 }
 
 func (utils *Utils) canWriteFile(path string) bool {
@@ -17,8 +17,9 @@ func TestValidateTransactionModeStopsOnFirstError(t *testing.T) {
 	pattern := regexp.MustCompile("test")
 	command := models.Command{
 		Action:  models.UPDATE,
+		Where:   &models.PatternPredicate{Operand: &models.ColumnOperand{Column: models.CONTENT_COLUMN}, Pattern: pattern},
 		Pattern: pattern,
-		Replace: "changed",
+		Replace: &models.LiteralOperand{Value: models.Value{Text: "changed"}},
 	}
 
 	stats := &models.ExecutionStats{}
@@ -44,8 +45,9 @@ func TestValidateNonTransactionModeContinuesAfterError(t *testing.T) {
 	pattern := regexp.MustCompile("content")
 	command := models.Command{
 		Action:  models.UPDATE,
+		Where:   &models.PatternPredicate{Operand: &models.ColumnOperand{Column: models.CONTENT_COLUMN}, Pattern: pattern},
 		Pattern: pattern,
-		Replace: "changed",
+		Replace: &models.LiteralOperand{Value: models.Value{Text: "changed"}},
 	}
 
 	stats := &models.ExecutionStats{}
@@ -70,8 +72,9 @@ func TestValidatePermissionDenied(t *testing.T) {
 	pattern := regexp.MustCompile("content")
 	command := models.Command{
 		Action:  models.UPDATE,
+		Where:   &models.PatternPredicate{Operand: &models.ColumnOperand{Column: models.CONTENT_COLUMN}, Pattern: pattern},
 		Pattern: pattern,
-		Replace: "changed",
+		Replace: &models.LiteralOperand{Value: models.Value{Text: "changed"}},
 	}
 
 	stats := &models.ExecutionStats{}
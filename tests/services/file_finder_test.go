@@ -2,8 +2,11 @@ package tests
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/albertoboccolini/sqd/models"
 	"github.com/albertoboccolini/sqd/services"
 )
 
@@ -58,3 +61,151 @@ func TestIsTextFileControlChars(t *testing.T) {
 		t.Error("file with control chars should not be text")
 	}
 }
+
+func TestWalkSourcesStopsWhenVisitReturnsFalse(t *testing.T) {
+	for _, name := range []string{"walk1.walk", "walk2.walk", "walk3.walk"} {
+		os.WriteFile(name, []byte("text"), 0644)
+		defer os.Remove(name)
+	}
+
+	fileFinder := services.NewFileFinder()
+
+	visited := 0
+	fileFinder.WalkSources([]string{"*.walk"}, nil, func(path string) bool {
+		visited++
+		return false
+	})
+
+	if visited != 1 {
+		t.Errorf("expected the walk to stop after 1 file, visited %d", visited)
+	}
+
+	if files := fileFinder.FindFiles("*.walk"); len(files) != 3 {
+		t.Errorf("expected 3 files, got %d", len(files))
+	}
+}
+
+func TestFindFilesMatchesRelativePaths(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "glob")
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"r.md", "a/one.md", "a/b/two.md", "a/b/skip.txt", "x/m.go", "y/n.go", "z/o.go"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("text"), 0644)
+	}
+
+	fileFinder := services.NewFileFinder()
+
+	tests := []struct {
+		pattern  string
+		expected int
+	}{
+		{root + "/*.md", 1},
+		{root + "/**/*.md", 3},
+		{root + "/a/**", 3},
+		{root + "/{x,y}/*.go", 2},
+		{root + "/[!x]/?.go", 2},
+		{"*.md", 3},
+	}
+
+	for _, test := range tests {
+		files := fileFinder.FindFiles(test.pattern)
+		count := 0
+		for _, file := range files {
+			if strings.HasPrefix(filepath.ToSlash(file), filepath.Base(root)+"/") {
+				count++
+			}
+		}
+
+		if count != test.expected {
+			t.Errorf("%s: expected %d files, got %v", test.pattern, test.expected, files)
+		}
+	}
+}
+
+func TestFindFilesDeduplicatesSources(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "glob")
+	defer os.RemoveAll(root)
+
+	os.WriteFile(filepath.Join(root, "a.md"), []byte("text"), 0644)
+	os.WriteFile(filepath.Join(root, "b.txt"), []byte("text"), 0644)
+
+	fileFinder := services.NewFileFinder()
+	files := fileFinder.FindFiles(root+"/*.md", root+"/*", root+"/a.md")
+
+	if len(files) != 2 || filepath.Base(files[0]) != "a.md" {
+		t.Errorf("expected a.md then b.txt once each, got %v", files)
+	}
+}
+
+func TestFindFilesSkipsIgnoredAndHiddenFiles(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "glob")
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"kept.md", "skipped.md", "out/built.md", ".hidden/secret.md", ".git/HEAD.md"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("text"), 0644)
+	}
+	os.WriteFile(filepath.Join(root, ".sqdignore"), []byte("skipped.md\nout/\n"), 0644)
+
+	fileFinder := services.NewFileFinder()
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 1 {
+		t.Errorf("expected only kept.md, got %v", files)
+	}
+
+	fileFinder.SetOptions(models.FindOptions{NoIgnore: true, Hidden: true})
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 4 {
+		t.Errorf("expected every file but .git, got %v", files)
+	}
+}
+
+func TestFindSourcesExcludesAndLimitsDepth(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "glob")
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"top.md", "vendor/lib/v.md", "a/a.md", "a/b/b.md", "a/b/c/c.md"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("text"), 0644)
+	}
+
+	fileFinder := services.NewFileFinder()
+	files := fileFinder.FindSources([]string{root + "/**/*.md"}, []string{root + "/vendor/**", "b"})
+	if len(files) != 2 {
+		t.Errorf("expected top.md and a/a.md, got %v", files)
+	}
+
+	fileFinder.SetOptions(models.FindOptions{Exclude: []string{"*.md"}})
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 0 {
+		t.Errorf("expected every file to be excluded, got %v", files)
+	}
+
+	fileFinder.SetOptions(models.FindOptions{MaxDepth: 3})
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 2 {
+		t.Errorf("expected top.md and a/a.md, got %v", files)
+	}
+}
+
+func TestFindFilesFollowsSymlinksOnce(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "glob")
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(filepath.Join(root, "real"), 0755)
+	os.WriteFile(filepath.Join(root, "real", "r.md"), []byte("text"), 0644)
+	if err := os.Symlink("..", filepath.Join(root, "real", "loop")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	os.Symlink("real", filepath.Join(root, "link"))
+
+	fileFinder := services.NewFileFinder()
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 1 {
+		t.Errorf("expected symlinks to be skipped, got %v", files)
+	}
+
+	fileFinder.SetOptions(models.FindOptions{FollowSymlinks: true})
+	if files := fileFinder.FindFiles(root + "/**/*.md"); len(files) != 1 {
+		t.Errorf("expected the linked directory to be walked once, got %v", files)
+	}
+}
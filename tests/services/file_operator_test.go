@@ -20,7 +20,7 @@ func TestTransactionPreservesFilePermissions(t *testing.T) {
 	utils := services.NewUtils()
 	sqlParser := services.NewSQLParser()
 
-	command := sqlParser.Parse("UPDATE test.txt SET content='NEW' WHERE content = 'content'")
+	command, _ := sqlParser.Parse("UPDATE test.txt SET content='NEW' WHERE content = 'content'")
 
 	fileOperator := services.NewFileOperator(utils)
 	fileOperator.ExecuteCommand(command, []string{file}, true, false)
@@ -40,7 +40,7 @@ func TestTransactionEmptyFileHandling(t *testing.T) {
 	utils := services.NewUtils()
 	sqlParser := services.NewSQLParser()
 
-	command := sqlParser.Parse("UPDATE test.txt SET content='NEW' WHERE content = 'nonexistent'")
+	command, _ := sqlParser.Parse("UPDATE test.txt SET content='NEW' WHERE content = 'nonexistent'")
 
 	fileOperator := services.NewFileOperator(utils)
 	fileOperator.ExecuteCommand(command, []string{file}, true, false)
@@ -61,7 +61,7 @@ func TestTransactionWithTrailingNewline(t *testing.T) {
 	utils := services.NewUtils()
 	sqlParser := services.NewSQLParser()
 
-	command := sqlParser.Parse("UPDATE test.txt SET content='UPDATED' WHERE content = 'line2'")
+	command, _ := sqlParser.Parse("UPDATE test.txt SET content='UPDATED' WHERE content = 'line2'")
 
 	fileOperator := services.NewFileOperator(utils)
 	fileOperator.ExecuteCommand(command, []string{file}, true, false)
@@ -90,7 +90,7 @@ func TestTransactionMultipleFilesSuccess(t *testing.T) {
 	utils := services.NewUtils()
 	sqlParser := services.NewSQLParser()
 
-	command := sqlParser.Parse("UPDATE *.txt SET content='CHANGED' WHERE content LIKE 'test'")
+	command, _ := sqlParser.Parse("UPDATE *.txt SET content='CHANGED' WHERE content LIKE 'test'")
 
 	fileOperator := services.NewFileOperator(utils)
 	fileOperator.ExecuteCommand(command, []string{file1, file2, file3}, true, false)
@@ -109,3 +109,393 @@ func TestTransactionMultipleFilesSuccess(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateWithFilteredWhereReplacesMatchedText(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "compound.txt")
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+	fileOperator := services.NewFileOperator(utils)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"UPDATE compound.txt SET content='QUX' WHERE content LIKE '%bar%' AND line > 0", "foo QUX baz\nQUX two\nother"},
+		{"UPDATE compound.txt SET content='QUX' WHERE line = 2 AND content LIKE '%bar%' AND NOT content LIKE '%baz'", "foo bar baz\nQUX two\nother"},
+		{"UPDATE compound.txt SET content='QUX' WHERE content LIKE '%bar%' OR content = 'other'", "QUX\nQUX\nQUX"},
+	}
+
+	for _, test := range tests {
+		os.WriteFile(file, []byte("foo bar baz\nbar two\nother"), 0644)
+
+		command, err := sqlParser.Parse(test.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.query, err)
+		}
+		fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+		if result, _ := os.ReadFile(file); string(result) != test.expected {
+			t.Errorf("%s: got %q, want %q", test.query, result, test.expected)
+		}
+	}
+}
+
+func TestDeleteWithOrWhere(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "delete_or.txt")
+	os.WriteFile(file, []byte("a\nb\nc"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("DELETE FROM delete_or.txt WHERE content = 'a' OR content = 'c'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "b" {
+		t.Errorf("got %q, want %q", string(result), "b")
+	}
+}
+
+func TestUpdateExpandsRegexpCaptureGroups(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "captures.md")
+	os.WriteFile(file, []byte("# Intro\ntext\n# Usage"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE captures.md SET content='## $1 (${name})' WHERE content ~ '^# (?P<name>.*)$'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	expected := "## Intro (Intro)\ntext\n## Usage (Usage)"
+	if string(result) != expected {
+		t.Errorf("got %q, want %q", string(result), expected)
+	}
+}
+
+func TestUpdateLiteralDollarWithoutRegexp(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "dollar.txt")
+	os.WriteFile(file, []byte("price"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE dollar.txt SET content='$1' WHERE content = 'price'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "$1" {
+		t.Errorf("got %q, want %q", string(result), "$1")
+	}
+}
+
+func TestUpdateReplaceFunctionSwapsOnlySubstring(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "replace.txt")
+	os.WriteFile(file, []byte("call oldName(oldName)\noldName stays"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE replace.txt SET content = REPLACE(content, 'oldName', 'newName') WHERE content LIKE 'call%'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	expected := "call newName(newName)\noldName stays"
+	if string(result) != expected {
+		t.Errorf("got %q, want %q", string(result), expected)
+	}
+}
+
+func TestDeleteByLineNumber(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "lines.txt")
+	os.WriteFile(file, []byte("---\ntitle: x\n---\nbody ---"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("DELETE FROM lines.txt WHERE line <= 3")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "body ---" {
+		t.Errorf("got %q, want %q", string(result), "body ---")
+	}
+}
+
+func TestTransactionPathConditionIgnoresBackupSuffix(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "path_condition.txt")
+	os.WriteFile(file, []byte("old"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE path_condition.txt SET content='new' WHERE filename = 'path_condition.txt' AND content = 'old'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, true, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "new" {
+		t.Errorf("got %q, want %q", string(result), "new")
+	}
+}
+
+func TestDeleteLimitStopsAcrossFiles(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file1 := filepath.Join(cwd, "limit1.txt")
+	file2 := filepath.Join(cwd, "limit2.txt")
+	os.WriteFile(file1, []byte("a\nb\na"), 0644)
+	os.WriteFile(file2, []byte("a\na"), 0644)
+	defer os.Remove(file1)
+	defer os.Remove(file2)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("DELETE FROM *.txt WHERE content = 'a' LIMIT 3")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file1, file2}, false, false)
+
+	result1, _ := os.ReadFile(file1)
+	result2, _ := os.ReadFile(file2)
+
+	if string(result1) != "b" || string(result2) != "a" {
+		t.Errorf("expected only the first 3 matches deleted, got %q and %q", result1, result2)
+	}
+}
+
+func TestUpdateWithSeveralWorkers(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "workers")
+	defer os.RemoveAll(root)
+
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		file := filepath.Join(root, name)
+		os.WriteFile(file, []byte("old\nkeep\nold"), 0644)
+		files = append(files, file)
+	}
+
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE *.txt SET content = 'new' WHERE content = 'old'")
+
+	fileOperator := services.NewFileOperator(services.NewUtils())
+	fileOperator.SetWorkers(3)
+	if !fileOperator.ExecuteCommand(command, files, false, false) {
+		t.Fatal("expected the update to succeed")
+	}
+
+	for _, file := range files {
+		if result, _ := os.ReadFile(file); string(result) != "new\nkeep\nnew" {
+			t.Errorf("%s: unexpected content %q", file, result)
+		}
+	}
+}
+
+func TestUpdateLimitInTransaction(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "limit.txt")
+	os.WriteFile(file, []byte("x\nx\nx"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE limit.txt SET content = 'y' WHERE content = 'x' LIMIT 2")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, true, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "y\ny\nx" {
+		t.Errorf("expected the first 2 lines updated, got %q", result)
+	}
+}
+
+func TestUpdateWithConcatExpression(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "todo.md")
+	os.WriteFile(file, []byte("- [ ] buy milk\n- [x] done\nnotes"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE todo.md SET content = '- [x]' || SUBSTR(content, 6) WHERE content LIKE '- [ ]%'")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "- [x] buy milk\n- [x] done\nnotes" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestUpdateWithCaseExpression(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "case.md")
+	os.WriteFile(file, []byte("alpha\nbeta\ngamma"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("UPDATE case.md SET content = CASE WHEN content LIKE 'a%' THEN UPPER(content) WHEN content = 'beta' THEN 'b' ELSE content END WHERE line < 3")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "ALPHA\nb\ngamma" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestInsertInTransaction(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "insert.md")
+	os.WriteFile(file, []byte("# Changelog\n\n## 1.0\n"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, _ := sqlParser.Parse("INSERT INTO insert.md VALUES ('## 1.1', '') BEFORE WHERE content LIKE '## %' LIMIT 1")
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, true, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "# Changelog\n\n## 1.1\n\n## 1.0\n" {
+		t.Errorf("unexpected result %q", result)
+	}
+
+	if _, err := os.Stat(file + services.BACKUP_SUFFIX); err == nil {
+		t.Error("the transaction backup should be gone")
+	}
+}
+
+func TestScriptTransactionRollsBackEveryStatement(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "script.log")
+	os.WriteFile(file, []byte("a\nb"), 0644)
+	defer os.Remove(file)
+
+	sqlParser := services.NewSQLParser()
+	commands, _ := sqlParser.ParseScript("DELETE FROM script.log WHERE content = 'b'; UPDATE script_missing.log SET content = 'x' WHERE line = 1")
+
+	fileOperator := services.NewFileOperator(services.NewUtils())
+	if fileOperator.ExecuteScript(commands, services.NewFileFinder(), true, false) {
+		t.Error("expected the script to fail")
+	}
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "a\nb" {
+		t.Errorf("expected the first statement to be rolled back, got %q", result)
+	}
+
+	if _, err := os.Stat(file + services.BACKUP_SUFFIX); err == nil {
+		t.Error("the script backup should be gone")
+	}
+}
+
+func TestScriptStopsAtFailingStatement(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "script.log")
+	os.WriteFile(file, []byte("a\nb"), 0644)
+	defer os.Remove(file)
+
+	outside := filepath.Join(os.TempDir(), "sqd_outside.log")
+	os.WriteFile(outside, []byte("a"), 0644)
+	defer os.Remove(outside)
+
+	link := filepath.Join(cwd, "script_link.log")
+	os.Symlink(outside, link)
+	defer os.Remove(link)
+
+	sqlParser := services.NewSQLParser()
+	commands, _ := sqlParser.ParseScript("UPDATE script_link.log SET content = 'x' WHERE line = 1; DELETE FROM script.log WHERE line = 1")
+
+	fileOperator := services.NewFileOperator(services.NewUtils())
+	if fileOperator.ExecuteScript(commands, services.NewFileFinder(), false, false) {
+		t.Error("expected the script to fail")
+	}
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "a\nb" {
+		t.Errorf("expected the script to stop before the second statement, got %q", result)
+	}
+}
+
+func TestScriptTransactionCommits(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "script.md")
+	os.WriteFile(file, []byte("# a\nb"), 0644)
+	defer os.Remove(file)
+
+	sqlParser := services.NewSQLParser()
+	commands, _ := sqlParser.ParseScript("DELETE FROM script.md WHERE content = 'b'; INSERT INTO script.md VALUES ('c') AT END")
+
+	fileOperator := services.NewFileOperator(services.NewUtils())
+	if !fileOperator.ExecuteScript(commands, services.NewFileFinder(), true, false) {
+		t.Error("expected the script to succeed")
+	}
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "# a\nc" {
+		t.Errorf("unexpected result %q", result)
+	}
+
+	if _, err := os.Stat(file + services.BACKUP_SUFFIX); err == nil {
+		t.Error("the script backup should be gone")
+	}
+}
+
+func TestBatchUpdateKeepsQuotesAndIndentation(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "quotes.txt")
+	os.WriteFile(file, []byte("a\nb"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	sqlParser := services.NewSQLParser()
+
+	command, err := sqlParser.Parse(`UPDATE quotes.txt SET content = '  ''single''' WHERE content = 'a', SET content = E"\t\"double\"" WHERE content = "b"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fileOperator := services.NewFileOperator(utils)
+	fileOperator.ExecuteCommand(command, []string{file}, false, false)
+
+	result, _ := os.ReadFile(file)
+	if string(result) != "  'single'\n\t\"double\"" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func walkNumbered(count int) func(visit func(file string) bool) {
+	return func(visit func(file string) bool) {
+		for i := 0; i < count; i++ {
+			if !visit(fmt.Sprintf("file%d", i)) {
+				return
+			}
+		}
+	}
+}
+
+func TestFilePoolCollectsInWalkOrder(t *testing.T) {
+	filePool := services.NewFilePool(8)
+
+	var files []string
+	filePool.Run(walkNumbered(50), func(file string) models.FileResult {
+		var index int
+		fmt.Sscanf(file, "file%d", &index)
+		time.Sleep(time.Duration(50-index) * 10 * time.Microsecond)
+		return models.FileResult{Count: index}
+	}, func(file string, result models.FileResult) bool {
+		if file != fmt.Sprintf("file%d", result.Count) {
+			t.Errorf("result %d was handed over with %s", result.Count, file)
+		}
+		files = append(files, file)
+		return true
+	})
+
+	if len(files) != 50 {
+		t.Fatalf("expected 50 results, got %d", len(files))
+	}
+
+	for i, file := range files {
+		if file != fmt.Sprintf("file%d", i) {
+			t.Fatalf("expected file%d at %d, got %s", i, i, file)
+		}
+	}
+}
+
+func TestFilePoolStopsWhenCollectReturnsFalse(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		filePool := services.NewFilePool(workers)
+
+		collected := 0
+		filePool.Run(walkNumbered(1000), func(file string) models.FileResult {
+			return models.FileResult{}
+		}, func(file string, result models.FileResult) bool {
+			collected++
+			return collected < 3
+		})
+
+		if collected != 3 {
+			t.Errorf("%d workers: expected 3 results before stopping, got %d", workers, collected)
+		}
+	}
+}
+
+func TestFilePoolStreamsRowsInWalkOrder(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		filePool := services.NewFilePool(workers)
+
+		var rows []string
+		var files []string
+		filePool.Stream(walkNumbered(20), func(file string, send func(row models.Row) bool) models.FileResult {
+			for line := 1; line <= 3; line++ {
+				if !send(models.Row{Path: file, Line: line}) {
+					break
+				}
+			}
+			return models.FileResult{}
+		}, func(row models.Row) bool {
+			rows = append(rows, fmt.Sprintf("%s:%d", row.Path, row.Line))
+			return len(rows) < 31
+		}, func(file string, result models.FileResult) bool {
+			files = append(files, file)
+			return true
+		})
+
+		if len(rows) != 31 || rows[30] != "file10:1" {
+			t.Errorf("%d workers: expected to stop at file10:1, got %d rows ending at %v", workers, len(rows), rows[len(rows)-1])
+		}
+
+		for i, row := range rows {
+			if expected := fmt.Sprintf("file%d:%d", i/3, i%3+1); row != expected {
+				t.Fatalf("%d workers: expected %s at %d, got %s", workers, expected, i, row)
+			}
+		}
+
+		if len(files) != 11 || files[10] != "file10" {
+			t.Errorf("%d workers: expected the stopped file to be collected last, got %v", workers, files)
+		}
+	}
+}
+
+func TestFilePoolStreamsRowsBeforeTheFileIsRead(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		filePool := services.NewFilePool(workers)
+		collected := make(chan struct{})
+
+		filePool.Stream(walkNumbered(1), func(file string, send func(row models.Row) bool) models.FileResult {
+			send(models.Row{Path: file, Line: 1})
+
+			select {
+			case <-collected:
+			case <-time.After(time.Second):
+				t.Errorf("%d workers: the first row was not collected while the file was still being read", workers)
+			}
+			return models.FileResult{}
+		}, func(row models.Row) bool {
+			close(collected)
+			return true
+		}, func(file string, result models.FileResult) bool {
+			return true
+		})
+	}
+}
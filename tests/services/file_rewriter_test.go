@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func upperCase(input io.Reader, info os.FileInfo, write func(line string)) (bool, error) {
+	err := services.NewLineReader().Each(input, func(line string) bool {
+		write(strings.ToUpper(line))
+		return true
+	})
+	return true, err
+}
+
+func TestFileRewriterReplacesFileAndKeepsMode(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "rewrite")
+	defer os.RemoveAll(root)
+
+	file := filepath.Join(root, "a.txt")
+	os.WriteFile(file, []byte("a\nb\n"), 0600)
+
+	if err := services.NewFileRewriter().Rewrite(file, upperCase); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, _ := os.ReadFile(file); string(content) != "A\nB\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("expected the temporary file to be gone, got %d entries", len(entries))
+	}
+}
+
+func TestFileRewriterLeavesUnchangedFileAlone(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "rewrite")
+	defer os.RemoveAll(root)
+
+	file := filepath.Join(root, "a.txt")
+	os.WriteFile(file, []byte("a"), 0644)
+
+	err := services.NewFileRewriter().Rewrite(file, func(input io.Reader, info os.FileInfo, write func(line string)) (bool, error) {
+		write("changed")
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, _ := os.ReadFile(file); string(content) != "a" {
+		t.Errorf("expected the file to be untouched, got %q", content)
+	}
+
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("expected the temporary file to be gone, got %d entries", len(entries))
+	}
+}
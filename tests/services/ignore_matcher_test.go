@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func TestIgnoreMatcherRules(t *testing.T) {
+	root, _ := os.MkdirTemp(".", "ignore")
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(filepath.Join(root, "src", "gen"), 0755)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("# comment\n*.log\n/build/\nvendor\n"), 0644)
+	os.WriteFile(filepath.Join(root, "src", ".ignore"), []byte("gen/*\n!gen/keep.go\n"), 0644)
+	os.WriteFile(filepath.Join(root, "src", ".sqdignore"), []byte("!debug.log\n"), 0644)
+
+	ignoreMatcher := services.NewIgnoreMatcher()
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"deep/dir/app.log", false, true},
+		{"src/debug.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, false},
+		{"vendor", true, true},
+		{"src/vendor", false, true},
+		{"src/gen/out.go", false, true},
+		{"src/gen/keep.go", false, false},
+		{"src/main.go", false, false},
+	}
+
+	for _, test := range tests {
+		if ignoreMatcher.IsIgnored(filepath.Join(root, test.path), test.isDir) != test.ignored {
+			t.Errorf("%s: expected ignored to be %v", test.path, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func TestLexerKeywordsAreCaseInsensitive(t *testing.T) {
+	lexer := services.NewLexer("select Where")
+
+	first := lexer.Next()
+	second := lexer.Next()
+
+	if first.Kind != models.KEYWORD || first.Value != "SELECT" {
+		t.Errorf("expected SELECT keyword, got %v %q", first.Kind, first.Value)
+	}
+
+	if second.Kind != models.KEYWORD || second.Value != "WHERE" {
+		t.Errorf("expected WHERE keyword, got %v %q", second.Kind, second.Value)
+	}
+}
+
+func TestLexerStringKeepsKeywordsAndCommas(t *testing.T) {
+	lexer := services.NewLexer("'a WHERE b, c'")
+	token := lexer.Next()
+
+	if token.Kind != models.STRING {
+		t.Fatalf("expected STRING, got %v", token.Kind)
+	}
+
+	if token.Value != "a WHERE b, c" {
+		t.Errorf("expected 'a WHERE b, c', got %q", token.Value)
+	}
+}
+
+func TestLexerStringDoubledQuote(t *testing.T) {
+	lexer := services.NewLexer(`'it''s'`)
+	token := lexer.Next()
+
+	if token.Value != "it's" {
+		t.Errorf("expected \"it's\", got %q", token.Value)
+	}
+}
+
+func TestLexerStringBackslashIsLiteral(t *testing.T) {
+	lexer := services.NewLexer(`'\' 'x'`)
+	token := lexer.Next()
+
+	if token.Kind != models.STRING || token.Value != `\` {
+		t.Errorf("expected a single backslash, got %v %q", token.Kind, token.Value)
+	}
+}
+
+func TestLexerUnterminatedString(t *testing.T) {
+	lexer := services.NewLexer("'open")
+	token := lexer.Next()
+
+	if token.Kind != models.ILLEGAL {
+		t.Errorf("expected ILLEGAL, got %v", token.Kind)
+	}
+}
+
+func TestLexerNextPath(t *testing.T) {
+	lexer := services.NewLexer("docs/*.md WHERE")
+	token := lexer.NextPath()
+
+	if token.Kind != models.PATH || token.Value != "docs/*.md" {
+		t.Errorf("expected path docs/*.md, got %v %q", token.Kind, token.Value)
+	}
+
+	if next := lexer.Next(); next.Value != "WHERE" {
+		t.Errorf("expected WHERE after path, got %q", next.Value)
+	}
+}
+
+func TestLexerNextPathKeepsBraceAlternatives(t *testing.T) {
+	lexer := services.NewLexer("src/{a,b}/*.go, *.md WHERE")
+	token := lexer.NextPath()
+
+	if token.Kind != models.PATH || token.Value != "src/{a,b}/*.go" {
+		t.Errorf("expected src/{a,b}/*.go, got %v %q", token.Kind, token.Value)
+	}
+
+	if comma := lexer.Next(); comma.Kind != models.COMMA {
+		t.Errorf("expected a comma after the path, got %v %q", comma.Kind, comma.Value)
+	}
+
+	if next := lexer.NextPath(); next.Value != "*.md" {
+		t.Errorf("expected *.md, got %q", next.Value)
+	}
+}
+
+func TestLexerRegexpOperators(t *testing.T) {
+	lexer := services.NewLexer("~ !~")
+
+	if token := lexer.Next(); token.Kind != models.TILDE {
+		t.Errorf("expected ~, got %v", token.Kind)
+	}
+
+	if token := lexer.Next(); token.Kind != models.NOT_TILDE {
+		t.Errorf("expected !~, got %v", token.Kind)
+	}
+}
+
+func TestLexerSkipsComments(t *testing.T) {
+	lexer := services.NewLexer("-- header\nSELECT # columns\n'-- kept' -- trailing")
+
+	first := lexer.Next()
+	second := lexer.Next()
+	third := lexer.Next()
+
+	if first.Value != "SELECT" || first.Line != 2 {
+		t.Errorf("expected SELECT on line 2, got %q on line %d", first.Value, first.Line)
+	}
+
+	if second.Kind != models.STRING || second.Value != "-- kept" {
+		t.Errorf("expected the string to keep its dashes, got %v %q", second.Kind, second.Value)
+	}
+
+	if third.Kind != models.EOF {
+		t.Errorf("expected EOF after the trailing comment, got %v %q", third.Kind, third.Value)
+	}
+}
+
+func TestLexerNextPathSkipsComments(t *testing.T) {
+	lexer := services.NewLexer("# where\n  docs/*.md;")
+	token := lexer.NextPath()
+
+	if token.Kind != models.PATH || token.Value != "docs/*.md" {
+		t.Errorf("expected docs/*.md, got %v %q", token.Kind, token.Value)
+	}
+}
+
+func TestLexerParameters(t *testing.T) {
+	lexer := services.NewLexer("? :name_1 :")
+
+	positional := lexer.Next()
+	named := lexer.Next()
+	colon := lexer.Next()
+
+	if positional.Kind != models.PARAMETER || positional.Value != "?" {
+		t.Errorf("expected ? parameter, got %v %q", positional.Kind, positional.Value)
+	}
+
+	if named.Kind != models.PARAMETER || named.Value != ":name_1" {
+		t.Errorf("expected :name_1 parameter, got %v %q", named.Kind, named.Value)
+	}
+
+	if colon.Kind != models.ILLEGAL {
+		t.Errorf("expected a lone colon to be illegal, got %v", colon.Kind)
+	}
+}
+
+func TestLexerEscapeString(t *testing.T) {
+	lexer := services.NewLexer(`E'a\tb\nc \'d\' \\ \q' e"x\"y"`)
+
+	first := lexer.Next()
+	if first.Kind != models.STRING || first.Value != "a\tb\nc 'd' \\ q" {
+		t.Errorf("unexpected E-string %v %q", first.Kind, first.Value)
+	}
+
+	second := lexer.Next()
+	if second.Kind != models.STRING || second.Value != `x"y` {
+		t.Errorf("unexpected double quoted E-string %v %q", second.Kind, second.Value)
+	}
+}
+
+func TestLexerStringKeepsSurroundingSpacesAndQuotes(t *testing.T) {
+	lexer := services.NewLexer(`"  ""quoted"" " '  '`)
+
+	first := lexer.Next()
+	second := lexer.Next()
+
+	if first.Value != `  "quoted" ` || second.Value != "  " {
+		t.Errorf("unexpected values %q and %q", first.Value, second.Value)
+	}
+}
+
+func TestLexerIdentifierStartingWithE(t *testing.T) {
+	lexer := services.NewLexer("ext = 'md'")
+	token := lexer.Next()
+
+	if token.Kind != models.IDENT || token.Value != "ext" {
+		t.Errorf("expected the ext identifier, got %v %q", token.Kind, token.Value)
+	}
+}
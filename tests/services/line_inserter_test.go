@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func insertInto(t *testing.T, content string, query string) string {
+	t.Helper()
+
+	command, err := services.NewSQLParser().Parse(query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var lines []string
+	_, err = services.NewLineInserter().Insert(strings.NewReader(content), "f.md", nil, command, func() bool { return true }, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestLineInserterAtStartAndEnd(t *testing.T) {
+	if result := insertInto(t, "a\nb\n", "INSERT INTO f.md VALUES ('top') AT START"); result != "top\na\nb\n" {
+		t.Errorf("unexpected AT START result %q", result)
+	}
+
+	if result := insertInto(t, "a\nb\n", "INSERT INTO f.md VALUES ('x', 'y') AT END"); result != "a\nb\nx\ny\n" {
+		t.Errorf("AT END should keep the trailing newline last, got %q", result)
+	}
+
+	if result := insertInto(t, "a", "INSERT INTO f.md VALUES ('x') AT END"); result != "a\nx" {
+		t.Errorf("unexpected AT END result %q", result)
+	}
+
+	if result := insertInto(t, "", "INSERT INTO f.md VALUES ('x') AT START"); result != "x\n" {
+		t.Errorf("unexpected result for an empty file %q", result)
+	}
+}
+
+func TestLineInserterAroundMatches(t *testing.T) {
+	content := "# A\ntext\n# B\n"
+
+	if result := insertInto(t, content, "INSERT INTO f.md VALUES ('> ' || content) AFTER WHERE content LIKE '# %'"); result != "# A\n> # A\ntext\n# B\n> # B\n" {
+		t.Errorf("unexpected AFTER result %q", result)
+	}
+
+	if result := insertInto(t, content, "INSERT INTO f.md VALUES ('') BEFORE WHERE line > 1 AND content LIKE '#%'"); result != "# A\ntext\n\n# B\n" {
+		t.Errorf("unexpected BEFORE result %q", result)
+	}
+}
+
+func TestLineInserterStopsWhenTakeRefuses(t *testing.T) {
+	command := models.Command{
+		Action:   models.INSERT,
+		Position: models.INSERT_AFTER,
+		Where:    &models.TruePredicate{},
+		Values:   []models.Operand{&models.LiteralOperand{Value: models.Value{Text: "-"}}},
+	}
+
+	remaining := 1
+	var lines []string
+	count, _ := services.NewLineInserter().Insert(strings.NewReader("a\nb"), "f.md", nil, command, func() bool {
+		remaining--
+		return remaining >= 0
+	}, func(line string) {
+		lines = append(lines, line)
+	})
+
+	if count != 1 || strings.Join(lines, "\n") != "a\n-\nb" {
+		t.Errorf("expected a single insertion, got %d: %q", count, lines)
+	}
+}
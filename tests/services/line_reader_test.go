@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func TestLineReaderSplitsLikeStringsSplit(t *testing.T) {
+	lineReader := services.NewLineReader()
+
+	for _, content := range []string{"", "a", "a\n", "a\n\nb", "\n", strings.Repeat("x", 100000) + "\ny"} {
+		var lines []string
+		err := lineReader.Each(strings.NewReader(content), func(line string) bool {
+			lines = append(lines, line)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected := strings.Split(content, "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") || len(lines) != len(expected) {
+			t.Errorf("%.10q: expected %d lines, got %d", content, len(expected), len(lines))
+		}
+	}
+}
+
+func TestLineReaderStopsWhenVisitReturnsFalse(t *testing.T) {
+	var lines []string
+	services.NewLineReader().Each(strings.NewReader("a\nb\nc"), func(line string) bool {
+		lines = append(lines, line)
+		return len(lines) < 2
+	})
+
+	if len(lines) != 2 {
+		t.Errorf("expected to stop after 2 lines, got %q", lines)
+	}
+}
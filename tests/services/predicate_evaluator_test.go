@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func TestMatchesAndOrNot(t *testing.T) {
+	content := &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	todo := &models.PatternPredicate{Operand: content, Pattern: regexp.MustCompile("TODO")}
+	done := &models.PatternPredicate{Operand: content, Pattern: regexp.MustCompile("done")}
+	exact := &models.PatternPredicate{Operand: content, Pattern: regexp.MustCompile("^x$"), MatchExact: true}
+
+	predicate := &models.OrPredicate{
+		Left:  &models.AndPredicate{Left: todo, Right: &models.NotPredicate{Operand: done}},
+		Right: exact,
+	}
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	cases := map[string]bool{
+		"TODO write docs": true,
+		"TODO done":       false,
+		"x":               true,
+		"nothing":         false,
+	}
+
+	for line, expected := range cases {
+		if predicateEvaluator.Matches(predicate, models.Row{Content: line}) != expected {
+			t.Errorf("line %q: expected %v", line, expected)
+		}
+	}
+}
+
+func TestMatchesNilPredicate(t *testing.T) {
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	if predicateEvaluator.Matches(nil, models.Row{Content: "anything"}) {
+		t.Error("nil predicate should not match")
+	}
+}
+
+func TestMatchesLineComparison(t *testing.T) {
+	predicate := &models.ComparisonPredicate{
+		Operator: models.GREATER,
+		Left:     &models.ColumnOperand{Column: models.LINE_COLUMN},
+		Right:    &models.LiteralOperand{Value: models.Value{Text: "9", Number: 9, IsNumber: true}},
+	}
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	if !predicateEvaluator.Matches(predicate, models.Row{Line: 10}) {
+		t.Error("line 10 should be greater than 9")
+	}
+
+	if predicateEvaluator.Matches(predicate, models.Row{Line: 9}) {
+		t.Error("line 9 should not be greater than 9")
+	}
+}
+
+func TestMatchesNumericComparisonWithStringLiteral(t *testing.T) {
+	predicate := &models.ComparisonPredicate{
+		Operator: models.LESS,
+		Left:     &models.ColumnOperand{Column: models.LINE_COLUMN},
+		Right:    &models.LiteralOperand{Value: models.Value{Text: "10"}},
+	}
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	if !predicateEvaluator.Matches(predicate, models.Row{Line: 9}) {
+		t.Error("line 9 should be compared numerically with '10'")
+	}
+}
+
+func TestEvaluateFileColumns(t *testing.T) {
+	file, _ := os.CreateTemp("", "columns*.md")
+	defer os.Remove(file.Name())
+	file.WriteString("12345")
+	file.Close()
+
+	info, _ := os.Stat(file.Name())
+	row := models.Row{Path: "docs/notes/todo.md", Info: info, Line: 1, Content: "12345"}
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	cases := map[models.Column]string{
+		models.PATH_COLUMN:     "docs/notes/todo.md",
+		models.FILENAME_COLUMN: "todo.md",
+		models.EXT_COLUMN:      "md",
+		models.DIR_COLUMN:      "docs/notes",
+		models.SIZE_COLUMN:     "5",
+		models.MTIME_COLUMN:    info.ModTime().Format(services.MTIME_LAYOUT),
+	}
+
+	for column, expected := range cases {
+		value := predicateEvaluator.Evaluate(&models.ColumnOperand{Column: column}, row)
+		if value.Text != expected {
+			t.Errorf("%s: got %q, want %q", column, value.Text, expected)
+		}
+	}
+}
+
+func TestMatchesMtimeAgainstDateLiteral(t *testing.T) {
+	file, _ := os.CreateTemp("", "mtime*.txt")
+	defer os.Remove(file.Name())
+	file.Close()
+
+	modified := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+	os.Chtimes(file.Name(), modified, modified)
+	info, _ := os.Stat(file.Name())
+
+	predicate := &models.ComparisonPredicate{
+		Operator: models.GREATER,
+		Left:     &models.ColumnOperand{Column: models.MTIME_COLUMN},
+		Right:    &models.LiteralOperand{Value: models.Value{Text: "2026-01-01"}},
+	}
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	if !predicateEvaluator.Matches(predicate, models.Row{Info: info}) {
+		t.Error("mtime in March 2026 should be after 2026-01-01")
+	}
+}
+
+func TestEvaluateScalarFunctions(t *testing.T) {
+	content := &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	row := models.Row{Content: "Héllo World"}
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	cases := map[string]string{
+		"UPPER":  "HÉLLO WORLD",
+		"LOWER":  "héllo world",
+		"LENGTH": "11",
+	}
+
+	for name, expected := range cases {
+		operand := &models.FunctionOperand{Name: name, Arguments: []models.Operand{content}}
+		value := predicateEvaluator.Evaluate(operand, row)
+		if value.Text != expected {
+			t.Errorf("%s: got %q, want %q", name, value.Text, expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func TestRowGrouperAggregatesPerGroup(t *testing.T) {
+	line := &models.ColumnOperand{Column: models.LINE_COLUMN}
+	aggregates := []*models.AggregateOperand{
+		{Name: "COUNT", Index: 0},
+		{Name: "SUM", Argument: line, Index: 1},
+		{Name: "MIN", Argument: line, Index: 2},
+		{Name: "MAX", Argument: line, Index: 3},
+		{Name: "AVG", Argument: line, Index: 4},
+	}
+	rowGrouper := services.NewRowGrouper([]models.Operand{&models.ColumnOperand{Column: models.PATH_COLUMN}}, aggregates)
+
+	rows := []models.Row{
+		{Path: "b.md", Line: 3},
+		{Path: "a.md", Line: 10},
+		{Path: "b.md", Line: 9},
+		{Path: "b.md", Line: 12},
+	}
+	for _, row := range rows {
+		rowGrouper.Add(row)
+	}
+
+	expected := map[string][]string{
+		"b.md": {"3", "24", "3", "12", "8"},
+		"a.md": {"1", "10", "10", "10", "10"},
+	}
+
+	var paths []string
+	rowGrouper.Each(func(row models.Row) bool {
+		paths = append(paths, row.Path)
+		for index, value := range row.Aggregates {
+			if value.Text != expected[row.Path][index] {
+				t.Errorf("%s aggregate %d: got %q, want %q", row.Path, index, value.Text, expected[row.Path][index])
+			}
+		}
+		return true
+	})
+
+	if len(paths) != 2 || paths[0] != "b.md" || paths[1] != "a.md" {
+		t.Errorf("expected groups in first seen order, got %v", paths)
+	}
+}
+
+func TestRowGrouperWithoutKeysReportsEmptyGroup(t *testing.T) {
+	rowGrouper := services.NewRowGrouper(nil, []*models.AggregateOperand{{Name: "COUNT"}})
+
+	groups := 0
+	rowGrouper.Each(func(row models.Row) bool {
+		groups++
+		if row.Aggregates[0].Text != "0" {
+			t.Errorf("expected COUNT(*) of 0, got %q", row.Aggregates[0].Text)
+		}
+		return true
+	})
+
+	if groups != 1 {
+		t.Errorf("expected a single group, got %d", groups)
+	}
+}
+
+func TestRowGrouperCountDistinct(t *testing.T) {
+	content := &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	aggregates := []*models.AggregateOperand{
+		{Name: "COUNT", Argument: content, Distinct: true, Index: 0},
+		{Name: "COUNT", Index: 1},
+	}
+	rowGrouper := services.NewRowGrouper(nil, aggregates)
+
+	for _, line := range []string{"import a", "import b", "import a", "import a"} {
+		rowGrouper.Add(models.Row{Content: line})
+	}
+
+	rowGrouper.Each(func(row models.Row) bool {
+		if row.Aggregates[0].Text != "2" || row.Aggregates[1].Text != "4" {
+			t.Errorf("expected 2 distinct of 4 rows, got %q of %q", row.Aggregates[0].Text, row.Aggregates[1].Text)
+		}
+		return true
+	})
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func sortedOutputs(rowSorter *services.RowSorter) []string {
+	var outputs []string
+	rowSorter.Each(func(output string) bool {
+		outputs = append(outputs, output)
+		return true
+	})
+	return outputs
+}
+
+func TestRowSorterOrdersByKeys(t *testing.T) {
+	keys := []models.SortKey{
+		{Operand: &models.ColumnOperand{Column: models.PATH_COLUMN}, Descending: true},
+		{Operand: &models.ColumnOperand{Column: models.LINE_COLUMN}},
+	}
+	rowSorter := services.NewRowSorter(keys, services.MAX_SORT_ROWS_IN_MEMORY)
+
+	rows := []models.Row{
+		{Path: "a.md", Line: 10},
+		{Path: "b.md", Line: 2},
+		{Path: "a.md", Line: 9},
+		{Path: "b.md", Line: 1},
+	}
+	for _, row := range rows {
+		rowSorter.Add(row, fmt.Sprintf("%s:%d", row.Path, row.Line))
+	}
+
+	expected := "b.md:1 b.md:2 a.md:9 a.md:10"
+	if got := strings.Join(sortedOutputs(rowSorter), " "); got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+}
+
+func TestRowSorterSpillsToDiskAndKeepsTiesInOrder(t *testing.T) {
+	length := &models.FunctionOperand{Name: "LENGTH", Arguments: []models.Operand{&models.ColumnOperand{Column: models.CONTENT_COLUMN}}}
+	rowSorter := services.NewRowSorter([]models.SortKey{{Operand: length}}, 2)
+
+	contents := []string{"ccc", "a", "bb", "x", "dddd", "y", "zz"}
+	for index, content := range contents {
+		rowSorter.Add(models.Row{Line: index + 1, Content: content}, content)
+	}
+
+	expected := "a x y bb zz ccc dddd"
+	if got := strings.Join(sortedOutputs(rowSorter), " "); got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+}
+
+func TestRowSorterStopsWhenVisitReturnsFalse(t *testing.T) {
+	content := &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	rowSorter := services.NewRowSorter([]models.SortKey{{Operand: content}}, 1)
+
+	for _, line := range []string{"c", "b", "a"} {
+		rowSorter.Add(models.Row{Content: line}, line)
+	}
+
+	var outputs []string
+	rowSorter.Each(func(output string) bool {
+		outputs = append(outputs, output)
+		return false
+	})
+
+	if len(outputs) != 1 || outputs[0] != "a" {
+		t.Errorf("expected only the first row, got %v", outputs)
+	}
+}
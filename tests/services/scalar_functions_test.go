@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/albertoboccolini/sqd/models"
+	"github.com/albertoboccolini/sqd/services"
+)
+
+func call(name string, arguments ...models.Operand) *models.FunctionOperand {
+	return &models.FunctionOperand{Name: name, Arguments: arguments}
+}
+
+func text(value string) *models.LiteralOperand {
+	return &models.LiteralOperand{Value: models.Value{Text: value}}
+}
+
+func number(value float64) *models.LiteralOperand {
+	return &models.LiteralOperand{Value: models.Value{Text: fmt.Sprint(value), Number: value, IsNumber: true}}
+}
+
+func TestScalarFunctions(t *testing.T) {
+	content := &models.ColumnOperand{Column: models.CONTENT_COLUMN}
+	row := models.Row{Content: "  héllo world "}
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	cases := []struct {
+		operand  models.Operand
+		expected string
+	}{
+		{call("TRIM", content), "héllo world"},
+		{call("LTRIM", content), "héllo world "},
+		{call("RTRIM", content), "  héllo world"},
+		{call("TRIM", text("--x--"), text("-")), "x"},
+		{call("SUBSTR", call("TRIM", content), number(2)), "éllo world"},
+		{call("SUBSTR", call("TRIM", content), number(2), number(4)), "éllo"},
+		{call("SUBSTR", text("abcdef"), number(-3), number(2)), "de"},
+		{call("SUBSTR", text("abc"), number(10)), ""},
+		{call("REPLACE", content, text("o"), text("0")), "  héll0 w0rld "},
+		{call("LPAD", text("7"), number(3), text("0")), "007"},
+		{call("RPAD", text("ab"), number(5), text("xy")), "abxyx"},
+		{call("LPAD", text("abcdef"), number(3)), "abc"},
+		{call("INSTR", content, text("world")), "9"},
+		{call("INSTR", content, text("missing")), "0"},
+		{call("CONCAT", text("a"), number(1), text("b")), "a1b"},
+	}
+
+	for _, testCase := range cases {
+		value := predicateEvaluator.Evaluate(testCase.operand, row)
+		if value.Text != testCase.expected {
+			t.Errorf("%s: got %q, want %q", testCase.operand.(*models.FunctionOperand).Name, value.Text, testCase.expected)
+		}
+	}
+}
@@ -1,60 +1,65 @@
 package tests
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/albertoboccolini/sqd/models"
 	"github.com/albertoboccolini/sqd/services"
 )
 
+func replaceText(operand models.Operand) string {
+	return services.NewPredicateEvaluator().Evaluate(operand, models.Row{}).Text
+}
+
+func matchesContent(command models.Command, content string) bool {
+	return services.NewPredicateEvaluator().Matches(command.Where, models.Row{Content: content})
+}
+
 func TestParseSelect(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM test.txt WHERE content LIKE '%foo%'")
+	command, _ := sqlParser.Parse("SELECT * FROM test.txt WHERE content LIKE '%foo%'")
 
 	if command.Action != models.SELECT {
 		t.Fatalf("expected SELECT, got %v", command.Action)
 	}
 
-	if command.File != "test.txt" {
-		t.Fatalf("expected test.txt, got %s", command.File)
+	if command.Sources[0] != "test.txt" {
+		t.Fatalf("expected test.txt, got %s", command.Sources[0])
 	}
 
-	if command.Pattern == nil {
-		t.Fatal("pattern is nil")
-	}
-
-	if !command.Pattern.MatchString("foo") {
+	if !matchesContent(command, "foo") {
 		t.Error("pattern should match 'foo'")
 	}
 }
 
 func TestParseCount(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT COUNT(*) FROM file.sql WHERE content = 'exact'")
+	command, _ := sqlParser.Parse("SELECT COUNT(*) FROM file.sql WHERE content = 'exact'")
 
 	if command.Action != models.COUNT {
 		t.Fatalf("expected COUNT, got %v", command.Action)
 	}
 
-	if command.File != "file.sql" {
-		t.Fatalf("expected file.sql, got %s", command.File)
+	if command.Sources[0] != "file.sql" {
+		t.Fatalf("expected file.sql, got %s", command.Sources[0])
 	}
 
-	if !command.MatchExact {
+	if !matchesContent(command, "exact") || matchesContent(command, "not exact") {
 		t.Error("expected exact match")
 	}
 }
 
 func TestParseUpdate(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("UPDATE file.txt SET content='new' WHERE content = 'old'")
+	command, _ := sqlParser.Parse("UPDATE file.txt SET content='new' WHERE content = 'old'")
 
 	if command.Action != models.UPDATE {
 		t.Fatalf("expected UPDATE, got %v", command.Action)
 	}
 
-	if command.Replace != "new" {
-		t.Fatalf("expected 'new', got %s", command.Replace)
+	if replaceText(command.Replace) != "new" {
+		t.Fatalf("expected 'new', got %s", replaceText(command.Replace))
 	}
 
 	if !command.MatchExact {
@@ -68,20 +73,20 @@ func TestParseUpdate(t *testing.T) {
 
 func TestParseDelete(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("DELETE FROM file.txt WHERE content = 'remove'")
+	command, _ := sqlParser.Parse("DELETE FROM file.txt WHERE content = 'remove'")
 
 	if command.Action != models.DELETE {
 		t.Fatalf("expected DELETE, got %v", command.Action)
 	}
 
-	if !command.MatchExact {
+	if !matchesContent(command, "remove") || matchesContent(command, "remove me") {
 		t.Error("expected exact match")
 	}
 }
 
 func TestParseBatchUpdate(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("UPDATE file.txt SET content='a' WHERE content = 'x', SET content='b' WHERE content = 'y'")
+	command, _ := sqlParser.Parse("UPDATE file.txt SET content='a' WHERE content = 'x', SET content='b' WHERE content = 'y'")
 
 	if !command.IsBatch {
 		t.Fatal("expected batch mode")
@@ -91,18 +96,18 @@ func TestParseBatchUpdate(t *testing.T) {
 		t.Fatalf("expected 2 replacements, got %d", len(command.Replacements))
 	}
 
-	if command.Replacements[0].Replace != "a" {
-		t.Errorf("first replacement: expected 'a', got %s", command.Replacements[0].Replace)
+	if replaceText(command.Replacements[0].Replace) != "a" {
+		t.Errorf("first replacement: expected 'a', got %s", replaceText(command.Replacements[0].Replace))
 	}
 
-	if command.Replacements[1].Replace != "b" {
-		t.Errorf("second replacement: expected 'b', got %s", command.Replacements[1].Replace)
+	if replaceText(command.Replacements[1].Replace) != "b" {
+		t.Errorf("second replacement: expected 'b', got %s", replaceText(command.Replacements[1].Replace))
 	}
 }
 
 func TestParseBatchDelete(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("DELETE FROM file.txt WHERE content = 'x', WHERE content = 'y'")
+	command, _ := sqlParser.Parse("DELETE FROM file.txt WHERE content = 'x', WHERE content = 'y'")
 
 	if !command.IsBatch {
 		t.Fatal("expected batch mode")
@@ -115,61 +120,999 @@ func TestParseBatchDelete(t *testing.T) {
 
 func TestLikePatternPrefix(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM f WHERE content LIKE '%test'")
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE '%test'")
 
-	if !command.Pattern.MatchString("mytest") {
+	if !matchesContent(command, "mytest") {
 		t.Error("should match 'mytest'")
 	}
 
-	if command.Pattern.MatchString("testing") {
+	if matchesContent(command, "testing") {
 		t.Error("should not match 'testing'")
 	}
 }
 
 func TestLikePatternSuffix(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'test%'")
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'test%'")
 
-	if !command.Pattern.MatchString("testing") {
+	if !matchesContent(command, "testing") {
 		t.Error("should match 'testing'")
 	}
 
-	if command.Pattern.MatchString("mytest") {
+	if matchesContent(command, "mytest") {
 		t.Error("should not match 'mytest'")
 	}
 }
 
 func TestLikePatternBoth(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM f WHERE content LIKE '%test%'")
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE '%test%'")
 
-	if !command.Pattern.MatchString("mytesting") {
+	if !matchesContent(command, "mytesting") {
 		t.Error("should match 'mytesting'")
 	}
 }
 
 func TestLikePatternExact(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'test'")
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'test'")
 
-	if !command.Pattern.MatchString("test") {
+	if !matchesContent(command, "test") {
 		t.Error("should match 'test'")
 	}
 
-	if !command.Pattern.MatchString("testing") {
+	if !matchesContent(command, "testing") {
 		t.Error("should match 'testing' (LIKE without % is 'contains')")
 	}
 }
 
 func TestExactMatch(t *testing.T) {
 	sqlParser := services.NewSQLParser()
-	command := sqlParser.Parse("SELECT * FROM f WHERE content = 'exact'")
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content = 'exact'")
 
-	if !command.Pattern.MatchString("exact") {
+	if !matchesContent(command, "exact") {
 		t.Error("should match 'exact'")
 	}
 
-	if command.Pattern.MatchString("not exact") {
+	if matchesContent(command, "not exact") {
 		t.Error("should not match 'not exact'")
 	}
 }
+
+func TestParseLiteralContainingKeyword(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE file.txt SET content='x WHERE y' WHERE content = 'a WHERE b'")
+
+	if replaceText(command.Replace) != "x WHERE y" {
+		t.Errorf("expected 'x WHERE y', got %q", replaceText(command.Replace))
+	}
+
+	if !command.Pattern.MatchString("a WHERE b") {
+		t.Error("pattern should match 'a WHERE b'")
+	}
+}
+
+func TestParseBatchUpdateLiteralContainingComma(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE file.txt SET content='a, b' WHERE content = 'x, y', SET content='c' WHERE content = 'z'")
+
+	if len(command.Replacements) != 2 {
+		t.Fatalf("expected 2 replacements, got %d", len(command.Replacements))
+	}
+
+	if replaceText(command.Replacements[0].Replace) != "a, b" {
+		t.Errorf("expected 'a, b', got %q", replaceText(command.Replacements[0].Replace))
+	}
+
+	if !command.Replacements[0].Pattern.MatchString("x, y") {
+		t.Error("first pattern should match 'x, y'")
+	}
+}
+
+func TestParsePreservesLeadingWhitespaceInLiteral(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE file.txt SET content='  indented' WHERE content = 'x'")
+
+	if replaceText(command.Replace) != "  indented" {
+		t.Errorf("expected '  indented', got %q", replaceText(command.Replace))
+	}
+}
+
+func TestParseStatementBuildsAST(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	statement, err := sqlParser.ParseStatement("DELETE FROM *.log WHERE content LIKE '%DEBUG%'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deleteStatement, ok := statement.(*models.DeleteStatement)
+	if !ok {
+		t.Fatalf("expected DeleteStatement, got %T", statement)
+	}
+
+	if deleteStatement.Sources[0] != "*.log" {
+		t.Errorf("expected *.log, got %s", deleteStatement.Sources[0])
+	}
+
+	if _, ok := deleteStatement.Wheres[0].(*models.LikeExpression); !ok {
+		t.Errorf("expected LikeExpression, got %T", deleteStatement.Wheres[0])
+	}
+}
+
+func TestParseStatementRejectsTrailingTokens(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.ParseStatement("SELECT * FROM f WHERE content = 'a' 'b'")
+
+	if err == nil {
+		t.Error("expected error for trailing tokens")
+	}
+}
+
+func TestParseUnknownVerbReturnsParseError(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELEC * FROM f WHERE content = 'x'")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+
+	if parseError.Line != 1 || parseError.Column != 1 {
+		t.Errorf("expected line 1 column 1, got line %d column %d", parseError.Line, parseError.Column)
+	}
+
+	if parseError.Suggestion != "SELECT" {
+		t.Errorf("expected suggestion SELECT, got %q", parseError.Suggestion)
+	}
+}
+
+func TestParseErrorReportsLineAndColumn(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT *\nFORM f WHERE content = 'x'")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+
+	if parseError.Line != 2 || parseError.Column != 1 {
+		t.Errorf("expected line 2 column 1, got line %d column %d", parseError.Line, parseError.Column)
+	}
+
+	if len(parseError.Expected) != 1 || parseError.Expected[0] != "FROM" {
+		t.Errorf("expected FROM to be expected, got %v", parseError.Expected)
+	}
+
+	if parseError.Suggestion != "FROM" {
+		t.Errorf("expected suggestion FROM, got %q", parseError.Suggestion)
+	}
+}
+
+func TestParseUnknownColumnSuggestsContent(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("DELETE FROM f WHERE contnet = 'x'")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+
+	if parseError.Column != 21 {
+		t.Errorf("expected column 21, got %d", parseError.Column)
+	}
+
+	if parseError.Suggestion != "content" {
+		t.Errorf("expected suggestion content, got %q", parseError.Suggestion)
+	}
+}
+
+func TestParseUnterminatedString(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("UPDATE f SET content = 'x")
+
+	if err == nil {
+		t.Fatal("expected error for unterminated string")
+	}
+}
+
+func TestParseBooleanWhere(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT * FROM f WHERE content LIKE '%TODO%' AND NOT content LIKE '%done%' OR (content = 'x')")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	or, ok := command.Where.(*models.OrPredicate)
+	if !ok {
+		t.Fatalf("expected OR at the root, got %T", command.Where)
+	}
+
+	and, ok := or.Left.(*models.AndPredicate)
+	if !ok {
+		t.Fatalf("expected AND on the left, got %T", or.Left)
+	}
+
+	if _, ok := and.Right.(*models.NotPredicate); !ok {
+		t.Errorf("expected NOT inside AND, got %T", and.Right)
+	}
+}
+
+func TestParseParenthesesOverridePrecedence(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE (content = 'a' OR content = 'b') AND content LIKE 'a'")
+
+	if _, ok := command.Where.(*models.AndPredicate); !ok {
+		t.Fatalf("expected AND at the root, got %T", command.Where)
+	}
+}
+
+func TestParseUnclosedParenthesis(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT * FROM f WHERE (content = 'a'")
+
+	if err == nil {
+		t.Error("expected error for unclosed parenthesis")
+	}
+}
+
+func TestParseRegexp(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT * FROM f WHERE content REGEXP '^v[0-9]+\\.[0-9]+$'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !matchesContent(command, "v1.25") {
+		t.Error("should match 'v1.25'")
+	}
+
+	if matchesContent(command, "version v1.25") {
+		t.Error("should not match 'version v1.25'")
+	}
+}
+
+func TestParseRegexpTildeAliases(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content ~ 'a+b'")
+	if !predicateEvaluator.Matches(command.Where, models.Row{Content: "xaab"}) {
+		t.Error("~ should match 'xaab'")
+	}
+
+	command, _ = sqlParser.Parse("SELECT * FROM f WHERE content !~ 'a+b'")
+	if predicateEvaluator.Matches(command.Where, models.Row{Content: "xaab"}) {
+		t.Error("!~ should not match 'xaab'")
+	}
+
+	if !predicateEvaluator.Matches(command.Where, models.Row{Content: "xyz"}) {
+		t.Error("!~ should match 'xyz'")
+	}
+}
+
+func TestParseInvalidRegexpReturnsParseError(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT * FROM f WHERE content REGEXP 'a(b'")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+
+	if parseError.Column != 38 {
+		t.Errorf("expected column 38, got %d", parseError.Column)
+	}
+}
+
+func TestParseReplaceFunctionRequiresThreeArguments(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("UPDATE f SET content = REPLACE(content, 'a') WHERE content LIKE 'a'")
+
+	if err == nil {
+		t.Error("expected error for REPLACE with two arguments")
+	}
+}
+
+func TestParseRegexpUpdateEnablesExpansion(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE f SET content = '$1' WHERE content ~ '(a)'")
+
+	if !command.Expand {
+		t.Error("REGEXP condition should enable capture group expansion")
+	}
+
+	command, _ = sqlParser.Parse("UPDATE f SET content = '$1' WHERE content LIKE 'a'")
+
+	if command.Expand {
+		t.Error("LIKE condition should keep the replacement literal")
+	}
+}
+
+func TestLikeUnderscoreMatchesSingleCharacter(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'v_.0'")
+
+	if !matchesContent(command, "v1.0") {
+		t.Error("should match 'v1.0'")
+	}
+
+	if matchesContent(command, "v10.0") {
+		t.Error("should not match 'v10.0'")
+	}
+
+	if matchesContent(command, "v1x0") {
+		t.Error("'.' should stay literal")
+	}
+}
+
+func TestLikeInnerPercent(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'foo%bar'")
+
+	if !matchesContent(command, "foo and bar") {
+		t.Error("should match 'foo and bar'")
+	}
+
+	if matchesContent(command, "foo and bar baz") {
+		t.Error("should not match 'foo and bar baz'")
+	}
+}
+
+func TestLikeEscape(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse(`SELECT * FROM f WHERE content LIKE '%100!%%' ESCAPE '!'`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !matchesContent(command, "coverage 100% done") {
+		t.Error("should match a literal %")
+	}
+
+	if matchesContent(command, "coverage 1000 done") {
+		t.Error("escaped % should not be a wildcard")
+	}
+}
+
+func TestLikeEscapeMustBeSingleCharacter(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT * FROM f WHERE content LIKE 'a' ESCAPE 'ab'")
+
+	if err == nil {
+		t.Error("expected error for multi character ESCAPE")
+	}
+}
+
+func TestIlikeAndNotLike(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	command, _ := sqlParser.Parse("SELECT * FROM f WHERE content ILIKE 'todo%'")
+	if !predicateEvaluator.Matches(command.Where, models.Row{Content: "TODO: docs"}) {
+		t.Error("ILIKE should ignore case")
+	}
+
+	command, _ = sqlParser.Parse("SELECT * FROM f WHERE content NOT LIKE '%done%'")
+	if predicateEvaluator.Matches(command.Where, models.Row{Content: "task done"}) {
+		t.Error("NOT LIKE should not match 'task done'")
+	}
+
+	if !predicateEvaluator.Matches(command.Where, models.Row{Content: "task open"}) {
+		t.Error("NOT LIKE should match 'task open'")
+	}
+}
+
+func TestBatchDeleteUsesLikeSemantics(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	predicateEvaluator := services.NewPredicateEvaluator()
+	command, _ := sqlParser.Parse("DELETE FROM f WHERE content LIKE 'a_c', WHERE content NOT ILIKE '%x%'")
+
+	if !predicateEvaluator.Matches(command.Deletions[0].Where, models.Row{Content: "abc"}) {
+		t.Error("first deletion should match 'abc'")
+	}
+
+	if predicateEvaluator.Matches(command.Deletions[1].Where, models.Row{Content: "aXb"}) {
+		t.Error("second deletion should not match 'aXb'")
+	}
+}
+
+func TestParseLineBetween(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	predicateEvaluator := services.NewPredicateEvaluator()
+	command, err := sqlParser.Parse("SELECT * FROM f WHERE line BETWEEN 10 AND 40 AND content LIKE '%x%'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !predicateEvaluator.Matches(command.Where, models.Row{Line: 10, Content: "x"}) {
+		t.Error("line 10 should be inside the range")
+	}
+
+	if predicateEvaluator.Matches(command.Where, models.Row{Line: 41, Content: "x"}) {
+		t.Error("line 41 should be outside the range")
+	}
+
+	if predicateEvaluator.Matches(command.Where, models.Row{Line: 20, Content: "y"}) {
+		t.Error("content should still be checked")
+	}
+}
+
+func TestParseLineNumberAliasAndOperators(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	predicateEvaluator := services.NewPredicateEvaluator()
+
+	cases := map[string]bool{
+		"line_number = 3":          true,
+		"line != 3":                false,
+		"line <> 4":                true,
+		"line <= 3":                true,
+		"line >= 4":                false,
+		"line NOT BETWEEN 1 AND 2": true,
+	}
+
+	for condition, expected := range cases {
+		command, err := sqlParser.Parse("SELECT * FROM f WHERE " + condition)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", condition, err)
+		}
+
+		if predicateEvaluator.Matches(command.Where, models.Row{Line: 3}) != expected {
+			t.Errorf("%s: expected %v for line 3", condition, expected)
+		}
+	}
+}
+
+func TestParseCannotUpdateLineColumn(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("UPDATE f SET line = 'x' WHERE line = 1")
+
+	if err == nil {
+		t.Error("expected error when assigning to line")
+	}
+}
+
+func TestParseSelectColumns(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT path, line, content FROM *.md WHERE path LIKE 'docs/%'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if command.Action != models.SELECT {
+		t.Fatalf("expected SELECT, got %v", command.Action)
+	}
+
+	if len(command.Columns) != 3 {
+		t.Fatalf("expected 3 columns, got %d", len(command.Columns))
+	}
+
+	if column, ok := command.Columns[0].(*models.ColumnOperand); !ok || column.Column != models.PATH_COLUMN {
+		t.Errorf("expected path as first column, got %v", command.Columns[0])
+	}
+}
+
+func TestParseUpdateWithPathConditionReplacesWholeLine(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE *.md SET content = 'x' WHERE path LIKE 'docs/%'")
+
+	if command.Pattern != nil {
+		t.Error("a path condition should not be used as the content pattern")
+	}
+}
+
+func TestParseSelectStarWithColumnsFails(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT *, path FROM f")
+
+	if err == nil {
+		t.Error("expected error when mixing * with columns")
+	}
+}
+
+func TestParseSelectExpressionsAndAliases(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT path AS file, upper(content), LENGTH(content) AS width FROM *.md WHERE line > 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(command.Columns) != 3 {
+		t.Fatalf("expected 3 columns, got %d", len(command.Columns))
+	}
+
+	if function, ok := command.Columns[1].(*models.FunctionOperand); !ok || function.Name != "UPPER" {
+		t.Errorf("expected UPPER as second column, got %v", command.Columns[1])
+	}
+}
+
+func TestParseSelectUnknownFunctionSuggestsName(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT UPPR(content) FROM f WHERE line > 0")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	if parseError.Suggestion != "UPPER" {
+		t.Errorf("expected suggestion UPPER, got %q", parseError.Suggestion)
+	}
+}
+
+func TestParseSelectFunctionArity(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT LOWER(content, path) FROM f WHERE line > 0")
+
+	if err == nil {
+		t.Error("expected error for LOWER with two arguments")
+	}
+}
+
+func TestParseLimitAndOffset(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+
+	command, err := sqlParser.Parse("SELECT * FROM *.md WHERE content LIKE '%TODO%' LIMIT 10 OFFSET 5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !command.HasLimit || command.Limit != 10 || command.Offset != 5 {
+		t.Errorf("expected LIMIT 10 OFFSET 5, got %v %d %d", command.HasLimit, command.Limit, command.Offset)
+	}
+
+	command, _ = sqlParser.Parse("UPDATE f SET content = 'a' WHERE content = 'b', SET content = 'c' WHERE content = 'd' LIMIT 2")
+	if !command.IsBatch || !command.HasLimit || command.Limit != 2 {
+		t.Errorf("expected batch UPDATE with LIMIT 2, got %v %v %d", command.IsBatch, command.HasLimit, command.Limit)
+	}
+
+	command, _ = sqlParser.Parse("DELETE FROM f WHERE line > 1 LIMIT 0")
+	if !command.HasLimit || command.Limit != 0 {
+		t.Errorf("expected DELETE with LIMIT 0, got %v %d", command.HasLimit, command.Limit)
+	}
+}
+
+func TestParseLimitRejectsFraction(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT * FROM f WHERE line > 1 LIMIT 1.5")
+
+	if err == nil {
+		t.Error("expected error for a fractional LIMIT")
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT path, LENGTH(content) AS width FROM *.md WHERE line > 0 ORDER BY width DESC, 1, content ASC LIMIT 3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(command.OrderBy) != 3 {
+		t.Fatalf("expected 3 sort keys, got %d", len(command.OrderBy))
+	}
+
+	if command.OrderBy[0].Operand != command.Columns[1] || !command.OrderBy[0].Descending {
+		t.Error("expected width DESC to refer to the second column")
+	}
+
+	if command.OrderBy[1].Operand != command.Columns[0] || command.OrderBy[1].Descending {
+		t.Error("expected position 1 to refer to the first column")
+	}
+
+	if column, ok := command.OrderBy[2].Operand.(*models.ColumnOperand); !ok || column.Column != models.CONTENT_COLUMN {
+		t.Errorf("expected content as third key, got %v", command.OrderBy[2].Operand)
+	}
+
+	if !command.HasLimit || command.Limit != 3 {
+		t.Error("expected LIMIT 3 after ORDER BY")
+	}
+}
+
+func TestParseOrderByPositionOutOfRange(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT * FROM f WHERE line > 0 ORDER BY 1")
+
+	if err == nil {
+		t.Error("expected error for a position with SELECT *")
+	}
+}
+
+func TestParseGroupByWithHaving(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT path, COUNT(*) AS open FROM *.md WHERE content LIKE '%- [ ]%' GROUP BY path HAVING COUNT(*) > 2 ORDER BY open DESC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if command.Action != models.SELECT || !command.IsGrouped {
+		t.Fatalf("expected a grouped SELECT, got %v %v", command.Action, command.IsGrouped)
+	}
+
+	if len(command.GroupBy) != 1 || command.Having == nil {
+		t.Errorf("expected one GROUP BY key and a HAVING clause")
+	}
+
+	if len(command.Aggregates) != 2 {
+		t.Fatalf("expected 2 aggregates, got %d", len(command.Aggregates))
+	}
+
+	if command.OrderBy[0].Operand != command.Aggregates[0] {
+		t.Error("expected ORDER BY open to reuse the COUNT(*) column")
+	}
+}
+
+func TestParseSelectWithoutWhereMatchesEveryLine(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	queries := []string{
+		"SELECT * FROM *.md",
+		"SELECT path, COUNT(*) FROM *.md GROUP BY path HAVING COUNT(*) > 1",
+		"SELECT COUNT(*) FROM *.md",
+	}
+
+	for _, query := range queries {
+		command, err := sqlParser.Parse(query)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", query, err)
+		}
+
+		if _, ok := command.Where.(*models.TruePredicate); !ok {
+			t.Errorf("expected %q to match every line, got %T", query, command.Where)
+		}
+	}
+}
+
+func TestParseCountAllWithoutGroupByKeepsCountAction(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("SELECT COUNT(*) FROM f WHERE line > 0")
+
+	if command.Action != models.COUNT || command.IsGrouped {
+		t.Errorf("expected the legacy COUNT action, got %v", command.Action)
+	}
+}
+
+func TestParseGroupByRejectsUngroupedColumns(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+
+	queries := []string{
+		"SELECT path, content, COUNT(*) FROM f WHERE line > 0 GROUP BY path",
+		"SELECT path FROM f WHERE COUNT(*) > 1",
+		"SELECT SUM(COUNT(*)) FROM f WHERE line > 0",
+		"SELECT * FROM f WHERE line > 0 GROUP BY path",
+		"SELECT path, COUNT(*) FROM f GROUP BY path HAVING content = 'X'",
+		"SELECT path, COUNT(*) FROM f GROUP BY path HAVING COUNT(*) > 1 AND NOT content LIKE '%x%'",
+		"SELECT path, COUNT(*) FROM f GROUP BY path ORDER BY line",
+		"SELECT COUNT(*) FROM f GROUP BY path ORDER BY UPPER(content)",
+	}
+
+	for _, query := range queries {
+		if _, err := sqlParser.Parse(query); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func TestParseGroupByAcceptsGroupValuesInHavingAndOrderBy(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("SELECT UPPER(path) AS name, COUNT(*) FROM f GROUP BY UPPER(path) HAVING UPPER(path) LIKE 'A%' AND MAX(line) > 2 ORDER BY name, MIN(content) DESC")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseDistinct(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+
+	command, err := sqlParser.Parse("SELECT DISTINCT content FROM *.go WHERE content LIKE 'import%'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !command.Distinct || command.IsGrouped {
+		t.Errorf("expected an ungrouped DISTINCT SELECT, got %v %v", command.Distinct, command.IsGrouped)
+	}
+
+	command, err = sqlParser.Parse("SELECT path, COUNT(DISTINCT content) FROM *.go WHERE line > 0 GROUP BY path")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(command.Aggregates) != 1 || !command.Aggregates[0].Distinct {
+		t.Error("expected a COUNT(DISTINCT content) aggregate")
+	}
+
+	if _, err := sqlParser.Parse("SELECT COUNT(DISTINCT *) FROM f WHERE line > 0"); err == nil {
+		t.Error("expected error for COUNT(DISTINCT *)")
+	}
+}
+
+func TestParseConcatInSetReplacesWholeLine(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("UPDATE *.md SET content = '- [x]' || SUBSTR(content, 6) WHERE content LIKE '- [ ]%'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if command.Pattern != nil {
+		t.Error("an expression reading content should replace the whole line")
+	}
+
+	value := services.NewPredicateEvaluator().Evaluate(command.Replace, models.Row{Content: "- [ ] buy milk"})
+	if value.Text != "- [x] buy milk" {
+		t.Errorf("unexpected replacement %q", value.Text)
+	}
+}
+
+func TestParseConstantExpressionKeepsMatchReplacement(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE f SET content = '#' || '## ' WHERE content LIKE '## %'")
+
+	if command.Pattern == nil || replaceText(command.Replace) != "### " {
+		t.Error("a constant expression should replace only the matched text")
+	}
+}
+
+func TestParseNegativeNumber(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT SUBSTR(content, -3) FROM f WHERE line > -1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	value := services.NewPredicateEvaluator().Evaluate(command.Columns[0], models.Row{Content: "abcdef"})
+	if value.Text != "def" {
+		t.Errorf("expected def, got %q", value.Text)
+	}
+}
+
+func TestParseCaseInSet(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("UPDATE f SET content = CASE WHEN content LIKE 'a%' THEN UPPER(content) WHEN content = 'b' THEN 'B' || content END")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+	if !predicateEvaluator.Matches(command.Where, models.Row{Content: "b"}) || predicateEvaluator.Matches(command.Where, models.Row{Content: "c"}) {
+		t.Error("a CASE without WHERE should only match the lines of its WHEN conditions")
+	}
+
+	tests := map[string]string{"abc": "ABC", "b": "Bb", "c": "c"}
+	for content, expected := range tests {
+		value := predicateEvaluator.Evaluate(command.Replace, models.Row{Content: content})
+		if value.Text != expected {
+			t.Errorf("CASE on %q: expected %q, got %q", content, expected, value.Text)
+		}
+	}
+}
+
+func TestParseCaseWithElseMatchesEveryLine(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, _ := sqlParser.Parse("UPDATE f SET content = CASE WHEN line = 1 THEN '# ' || content ELSE TRIM(content) END")
+
+	predicateEvaluator := services.NewPredicateEvaluator()
+	if !predicateEvaluator.Matches(command.Where, models.Row{Line: 5, Content: "x"}) {
+		t.Error("a CASE with ELSE should match every line")
+	}
+
+	value := predicateEvaluator.Evaluate(command.Replace, models.Row{Line: 2, Content: " x "})
+	if value.Text != "x" {
+		t.Errorf("unexpected ELSE value %q", value.Text)
+	}
+}
+
+func TestParseCaseRequiresWhen(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.Parse("UPDATE f SET content = CASE ELSE content END WHERE line = 1")
+	if err == nil {
+		t.Error("expected an error for CASE without WHEN")
+	}
+}
+
+func TestParseInsert(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("INSERT INTO *.md VALUES ('<!-- generated -->', '') AFTER WHERE line = 1 LIMIT 5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if command.Action != models.INSERT || command.Position != models.INSERT_AFTER || command.Sources[0] != "*.md" {
+		t.Errorf("unexpected command %+v", command)
+	}
+
+	if len(command.Values) != 2 || command.Where == nil || !command.HasLimit || command.Limit != 5 {
+		t.Errorf("unexpected values, where or limit in %+v", command)
+	}
+
+	command, _ = sqlParser.Parse("INSERT INTO f VALUES ('x') AT END")
+	if command.Position != models.INSERT_AT_END || command.Where != nil {
+		t.Errorf("unexpected AT END command %+v", command)
+	}
+}
+
+func TestParseInsertRequiresPosition(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	for _, query := range []string{
+		"INSERT INTO f VALUES ('x')",
+		"INSERT INTO f VALUES ('x') AT MIDDLE",
+		"INSERT INTO f VALUES ('x') AFTER content = 'a'",
+		"INSERT INTO f VALUES () AT END",
+	} {
+		if _, err := sqlParser.Parse(query); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	commands, err := sqlParser.ParseScript("DELETE FROM *.log WHERE content LIKE '%DEBUG%';\n\nUPDATE *.md SET content = 'x' WHERE line = 1;;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(commands) != 2 || commands[0].Action != models.DELETE || commands[1].Action != models.UPDATE {
+		t.Fatalf("unexpected commands %+v", commands)
+	}
+
+	if commands[0].Sources[0] != "*.log" {
+		t.Errorf("the semicolon should not be part of the pattern, got %q", commands[0].Sources[0])
+	}
+}
+
+func TestParseScriptReportsErrorPosition(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	_, err := sqlParser.ParseScript("SELECT * FROM f WHERE line = 1;\nDELETE f")
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 2 || parseError.Column != 8 {
+		t.Errorf("expected an error at line 2, column 8, got %v", err)
+	}
+}
+
+func TestParseRejectsSeveralStatements(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	if _, err := sqlParser.Parse("SELECT * FROM f WHERE line = 1; SELECT * FROM g WHERE line = 1"); err == nil {
+		t.Error("Parse should only accept a single statement")
+	}
+
+	if _, err := sqlParser.Parse("SELECT * FROM f WHERE line = 1;"); err != nil {
+		t.Errorf("a trailing semicolon should be accepted, got %v", err)
+	}
+}
+
+func TestParseBindsParameters(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	sqlParser.SetParameters(map[string]string{"title": "it's 'quoted'"}, []string{"%TODO%", "3"})
+
+	command, err := sqlParser.Parse("UPDATE f SET content = :title WHERE content LIKE ? LIMIT ?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if replaceText(command.Replace) != "it's 'quoted'" {
+		t.Errorf("unexpected replacement %q", replaceText(command.Replace))
+	}
+
+	if command.Pattern == nil || !command.Pattern.MatchString("a TODO b") {
+		t.Error("expected the LIKE pattern to come from the first positional value")
+	}
+
+	if !command.HasLimit || command.Limit != 3 {
+		t.Errorf("expected LIMIT 3, got %d", command.Limit)
+	}
+}
+
+func TestParseParameterErrors(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	sqlParser.SetParameters(map[string]string{"n": "many"}, []string{"a", "b"})
+
+	tests := []string{
+		"SELECT * FROM f WHERE content = :missing",
+		"SELECT * FROM f WHERE content = ?",
+		"SELECT * FROM f WHERE content = ? OR content = ? LIMIT :n",
+	}
+
+	for _, query := range tests {
+		if _, err := sqlParser.Parse(query); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+
+	if _, err := sqlParser.Parse("SELECT * FROM f WHERE content = ? OR content = ?"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseRejectsNegativeLimitParameters(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	sqlParser.SetParameters(map[string]string{"n": "-1"}, nil)
+
+	tests := []string{
+		"DELETE FROM f WHERE line > 0 LIMIT :n",
+		"SELECT * FROM f WHERE line > 0 LIMIT 2 OFFSET :n",
+	}
+
+	for _, query := range tests {
+		_, err := sqlParser.Parse(query)
+
+		var parseError *models.ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("expected a parse error for %q, got %v", query, err)
+		}
+	}
+}
+
+func TestParseQuestionMarkInPatternIsNotAPlaceholder(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	command, err := sqlParser.Parse("SELECT * FROM file?.md WHERE line = 1")
+	if err != nil || command.Sources[0] != "file?.md" {
+		t.Errorf("unexpected file %q, %v", command.Sources[0], err)
+	}
+}
+
+func TestParseMultipleSources(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	tests := []string{
+		"SELECT * FROM 'a/*.md', b/*.txt WHERE line = 1",
+		"UPDATE 'a/*.md', b/*.txt SET content = 'x' WHERE line = 1",
+		"DELETE FROM 'a/*.md', b/*.txt WHERE line = 1",
+		"INSERT INTO 'a/*.md', b/*.txt VALUES ('x') AT END",
+	}
+
+	for _, query := range tests {
+		command, err := sqlParser.Parse(query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", query, err)
+		}
+
+		if len(command.Sources) != 2 || command.Sources[0] != "a/*.md" || command.Sources[1] != "b/*.txt" {
+			t.Errorf("%s: unexpected sources %q", query, command.Sources)
+		}
+	}
+}
+
+func TestParseExclude(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	tests := []string{
+		"SELECT * FROM '**/*.go' EXCLUDE 'vendor/**', *_test.go WHERE line = 1",
+		"UPDATE '**/*.go' EXCLUDE 'vendor/**', *_test.go SET content = 'x' WHERE line = 1",
+		"DELETE FROM '**/*.go' EXCLUDE 'vendor/**', *_test.go WHERE line = 1",
+		"INSERT INTO '**/*.go' EXCLUDE 'vendor/**', *_test.go VALUES ('x') AT END",
+	}
+
+	for _, query := range tests {
+		command, err := sqlParser.Parse(query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", query, err)
+		}
+
+		if len(command.Excludes) != 2 || command.Excludes[0] != "vendor/**" || command.Excludes[1] != "*_test.go" {
+			t.Errorf("%s: unexpected excludes %q", query, command.Excludes)
+		}
+	}
+}
+
+func TestParseUpdateAndDeleteRequireWhere(t *testing.T) {
+	sqlParser := services.NewSQLParser()
+	tests := []string{
+		"UPDATE a.md SET content = 'x'",
+		"UPDATE a.md SET content = 'x' LIMIT 1",
+		"UPDATE a.md SET content = 'x' WHERE line = 1, SET content = 'y'",
+		"DELETE FROM a.md",
+		"DELETE FROM a.md;",
+	}
+
+	for _, query := range tests {
+		_, err := sqlParser.Parse(query)
+
+		var parseError *models.ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%s: expected a parse error, got %v", query, err)
+			continue
+		}
+
+		if len(parseError.Expected) == 0 || parseError.Expected[0] != "WHERE" {
+			t.Errorf("%s: expected WHERE to be asked for, got %v", query, parseError)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package tests
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/albertoboccolini/sqd/models"
 	"github.com/albertoboccolini/sqd/services"
 )
 
@@ -57,3 +60,75 @@ func TestIsPathInsideCwdSymlink(t *testing.T) {
 		t.Error("symlink outside cwd should be invalid")
 	}
 }
+
+func TestReadScript(t *testing.T) {
+	cwd, _ := os.Getwd()
+	file := filepath.Join(cwd, "script.sql")
+	os.WriteFile(file, []byte("SELECT * FROM f WHERE line = 1;"), 0644)
+	defer os.Remove(file)
+
+	utils := services.NewUtils()
+	script, err := utils.ReadScript(file)
+	if err != nil || script != "SELECT * FROM f WHERE line = 1;" {
+		t.Errorf("unexpected script %q, %v", script, err)
+	}
+
+	if _, err := utils.ReadScript(filepath.Join(cwd, "missing.sql")); err == nil {
+		t.Error("expected an error for a missing script")
+	}
+}
+
+func captureStderr(run func()) string {
+	reader, writer, _ := os.Pipe()
+	stderr := os.Stderr
+	os.Stderr = writer
+	run()
+	os.Stderr = stderr
+	writer.Close()
+
+	output, _ := io.ReadAll(reader)
+	return string(output)
+}
+
+func TestPrintParseErrorPointsAtToken(t *testing.T) {
+	query := "SELECT *\n\tFORM f WHERE line = 1"
+	_, err := services.NewSQLParser().Parse(query)
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	output := captureStderr(func() {
+		services.NewUtils().PrintParseError(query, parseError)
+	})
+
+	expected := "Error: line 2, column 2: expected FROM, found \"FORM\"\n" +
+		"  \tFORM f WHERE line = 1\n" +
+		"  \t^\n" +
+		"Did you mean FROM?\n"
+	if output != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", output, expected)
+	}
+}
+
+func TestPrintParseErrorForMissingWhere(t *testing.T) {
+	query := "DELETE FROM f.md"
+	_, err := services.NewSQLParser().Parse(query)
+
+	var parseError *models.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	output := captureStderr(func() {
+		services.NewUtils().PrintParseError(query, parseError)
+	})
+
+	expected := "Error: line 1, column 17: expected WHERE, found end of query\n" +
+		"  DELETE FROM f.md\n" +
+		"                  ^\n"
+	if output != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", output, expected)
+	}
+}